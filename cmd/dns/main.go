@@ -1,7 +1,276 @@
 package main
 
-import dns "github.com/joegrn/dns/pkg"
+import (
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	dns "github.com/joegrn/dns/pkg"
+)
+
+// shutdownTimeout is how long in-flight queries get to finish once a signal
+// arrives, unless DNS_SHUTDOWN_TIMEOUT says otherwise.
+const shutdownTimeout = 10 * time.Second
+
+// dohReadTimeout bounds how long a DNS over HTTPS client may take to send a
+// request.
+const dohReadTimeout = 5 * time.Second
 
 func main() {
-	dns.Serve()
+	// NSID lets monitoring tell instances apart (RFC 5001)
+	if nsid := os.Getenv("DNS_NSID"); nsid != "" {
+		dns.DefaultEDNSConfig.NSID = []byte(nsid)
+	} else if hostname, err := os.Hostname(); err == nil {
+		dns.DefaultEDNSConfig.NSID = []byte(hostname)
+	}
+
+	// Instances behind one balancer must share the cookie secret, or a client
+	// moved to another instance has its cookie rejected (RFC 9018)
+	if value := os.Getenv("DNS_COOKIE_SECRET"); value != "" {
+		secret, err := hex.DecodeString(value)
+		if err != nil || len(secret) != len(dns.DefaultEDNSConfig.Cookies.Secret) {
+			fmt.Println("Invalid DNS_COOKIE_SECRET: want 32 hex digits")
+			os.Exit(2)
+		}
+		copy(dns.DefaultEDNSConfig.Cookies.Secret[:], secret)
+	}
+
+	// DNS_ZONES lists zones to serve as origin=file pairs, for example
+	// "example.com.=/etc/dns/example.com.zone". Names outside them are
+	// refused. Without zones every query gets the same answer.
+	if value := os.Getenv("DNS_ZONES"); value != "" {
+		for _, entry := range strings.Split(value, ",") {
+			origin, filename, ok := strings.Cut(entry, "=")
+			if !ok {
+				fmt.Printf("Invalid DNS_ZONES entry %q: want origin=file\n", entry)
+				os.Exit(2)
+			}
+			zone, err := dns.LoadZone(filename, origin)
+			if err != nil {
+				fmt.Printf("Failed to load zone %s: %v\n", origin, err)
+				os.Exit(1)
+			}
+			dns.Handle(origin, dns.Chain(zone, dns.WithRecovery(nil)))
+		}
+	} else {
+		dns.Handle(".", dns.Chain(dns.HandlerFunc(answerEverything), dns.WithRecovery(nil)))
+	}
+
+	// DNS_ADDR may list several addresses, e.g. "0.0.0.0:53,[::]:53"
+	addrs := []string{"127.0.0.1:2053"}
+	if value := os.Getenv("DNS_ADDR"); value != "" {
+		addrs = strings.Split(value, ",")
+	}
+
+	timeout := shutdownTimeout
+	if value := os.Getenv("DNS_SHUTDOWN_TIMEOUT"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			fmt.Println("Invalid DNS_SHUTDOWN_TIMEOUT:", err)
+			os.Exit(2)
+		}
+		timeout = parsed
+	}
+
+	// Under systemd the sockets are bound for us; otherwise bind them here
+	listeners, packetConns, err := dns.ActivationListeners()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if len(listeners) == 0 && len(packetConns) == 0 {
+		if listeners, packetConns, err = bind(addrs); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	// DNS over TLS is enabled by giving a certificate and key
+	var tlsListeners []net.Listener
+	var tlsConfig *tls.Config
+	var dohListener net.Listener
+	var dohConfig *tls.Config
+	var reloader *dns.CertificateReloader
+	if certFile := os.Getenv("DNS_TLS_CERT"); certFile != "" {
+		reloader, err = dns.NewCertificateReloader(certFile, os.Getenv("DNS_TLS_KEY"))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		tlsConfig = dns.NewTLSConfig(reloader)
+
+		tlsAddrs := []string{"127.0.0.1:2853"}
+		if value := os.Getenv("DNS_TLS_ADDR"); value != "" {
+			tlsAddrs = strings.Split(value, ",")
+		}
+		for _, addr := range tlsAddrs {
+			listener, err := net.Listen("tcp", addr)
+			if err != nil {
+				fmt.Printf("failed to bind to address %s: %v\n", addr, err)
+				os.Exit(1)
+			}
+			tlsListeners = append(tlsListeners, listener)
+		}
+
+		// DNS over HTTPS shares the certificate but negotiates HTTP itself
+		if value := os.Getenv("DNS_DOH_ADDR"); value != "" {
+			dohListener, err = net.Listen("tcp", value)
+			if err != nil {
+				fmt.Printf("failed to bind to address %s: %v\n", value, err)
+				os.Exit(1)
+			}
+			dohConfig = &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: reloader.GetCertificate}
+		}
+
+		reloadOnHangup(reloader)
+	}
+
+	// Privileged ports are already bound, so root is no longer needed
+	if username := os.Getenv("DNS_USER"); username != "" {
+		if err := dns.DropPrivileges(username, os.Getenv("DNS_GROUP")); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		// The certificate keeps working, but replacements could not be read
+		if reloader != nil {
+			if err := reloader.Reload(); err != nil {
+				fmt.Printf("Warning: %s cannot reload the certificate: %v\n", username, err)
+			}
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	server := &dns.Server{}
+
+	// Behind a load balancer, DNS_PROXY_TRUSTED lists the balancers whose
+	// PROXY protocol headers carry the real client address
+	if value := os.Getenv("DNS_PROXY_TRUSTED"); value != "" {
+		if server.ProxyTrusted, err = dns.ParseNetworks(strings.Split(value, ",")); err != nil {
+			fmt.Println("Invalid DNS_PROXY_TRUSTED:", err)
+			os.Exit(2)
+		}
+	}
+
+	errs := make(chan error, len(listeners)+len(packetConns)+len(tlsListeners)+1)
+	for _, packetConn := range packetConns {
+		go func() { errs <- server.Serve(packetConn) }()
+	}
+	for _, listener := range listeners {
+		go func() { errs <- server.ServeTCP(listener) }()
+	}
+	for _, listener := range tlsListeners {
+		go func() { errs <- server.ServeTLS(listener, tlsConfig) }()
+	}
+
+	doh := &dns.DoHHandler{Server: server, JSON: true}
+	routes := http.NewServeMux()
+	routes.Handle("/dns-query", doh)
+	routes.Handle("/resolve", doh)
+	// Slow and idle clients are cut off as on the other transports, which
+	// also close idle connections after the EDNS keepalive timeout
+	httpServer := &http.Server{
+		Handler:           routes,
+		TLSConfig:         dohConfig,
+		ReadHeaderTimeout: dohReadTimeout,
+		ReadTimeout:       dohReadTimeout,
+		IdleTimeout:       dns.DefaultEDNSConfig.KeepaliveTimeout,
+	}
+	if dohListener != nil {
+		go func() { errs <- httpServer.ServeTLS(dohListener, "", "") }()
+	}
+
+	status := 0
+	select {
+	case err := <-errs:
+		fmt.Println(err)
+		status = 1
+	case <-ctx.Done():
+		fmt.Println("Shutting down")
+	}
+	stop()
+
+	// In-flight queries get until the timeout to finish
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	if err := errors.Join(httpServer.Shutdown(shutdownCtx), server.Shutdown(shutdownCtx)); err != nil {
+		fmt.Println("Shutdown incomplete:", err)
+		status = 1
+	}
+	cancel()
+	os.Exit(status)
+}
+
+// bind opens a UDP socket and a TCP listener on every address. TCP carries
+// answers too large for UDP and retries after truncation.
+func bind(addrs []string) ([]net.Listener, []net.PacketConn, error) {
+	var listeners []net.Listener
+	var packetConns []net.PacketConn
+	closeAll := func() {
+		for _, listener := range listeners {
+			listener.Close()
+		}
+		for _, packetConn := range packetConns {
+			packetConn.Close()
+		}
+	}
+
+	for _, addr := range addrs {
+		packetConn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			closeAll()
+			return nil, nil, fmt.Errorf("failed to bind to address %s: %v", addr, err)
+		}
+		packetConns = append(packetConns, packetConn)
+
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			closeAll()
+			return nil, nil, fmt.Errorf("failed to bind to address %s: %v", addr, err)
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, packetConns, nil
+}
+
+// reloadOnHangup reloads the TLS certificate on SIGHUP. Replaced files are
+// also noticed on the next handshake, so this only makes the switch prompt.
+func reloadOnHangup(reloader *dns.CertificateReloader) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			if err := reloader.Reload(); err != nil {
+				fmt.Println("Failed to reload certificate:", err)
+				continue
+			}
+			fmt.Println("Reloaded certificate")
+		}
+	}()
+}
+
+func answerEverything(w dns.ResponseWriter, r *dns.Message) {
+	var response dns.Message
+	response.SetReply(r, false, false)
+
+	response.Answer = []dns.DNSAnswer{
+		{
+			Name:  r.Question[0].QName,
+			Type:  dns.TypeA,
+			Class: dns.ClassIN,
+			TTL:   60,
+			Data:  &dns.ARecord{IP: net.IPv4(8, 8, 8, 8)},
+		},
+	}
+
+	w.WriteMsg(&response)
 }
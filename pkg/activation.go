@@ -0,0 +1,49 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// listenFDsStart is the first descriptor passed by systemd socket activation.
+const listenFDsStart = 3
+
+// ActivationListeners returns the sockets passed in by systemd socket
+// activation (sd_listen_fds(3)), split into stream listeners for TCP and
+// packet connections for UDP. It returns nothing when the process was not
+// socket activated. The LISTEN_* variables are cleared so child processes do
+// not pick the sockets up again.
+func ActivationListeners() ([]net.Listener, []net.PacketConn, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, nil, nil
+	}
+
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	var listeners []net.Listener
+	var packetConns []net.PacketConn
+	for fd := listenFDsStart; fd < listenFDsStart+count; fd++ {
+		file := os.NewFile(uintptr(fd), fmt.Sprintf("LISTEN_FD_%d", fd))
+
+		// Both calls duplicate the descriptor, so the original is closed either way
+		if listener, err := net.FileListener(file); err == nil {
+			listeners = append(listeners, listener)
+		} else if packetConn, err := net.FilePacketConn(file); err == nil {
+			packetConns = append(packetConns, packetConn)
+		} else {
+			file.Close()
+			return nil, nil, fmt.Errorf("inherited descriptor %d is not a socket: %v", fd, err)
+		}
+		file.Close()
+	}
+	return listeners, packetConns, nil
+}
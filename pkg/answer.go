@@ -13,32 +13,94 @@ type DNSAnswer struct {
 	TTL      uint32
 	RDLength uint16
 	RData    []byte
+	Data     RData
+}
+
+func ReadDNSAnswer(reader *bytes.Reader) (DNSAnswer, error) {
+	var answer DNSAnswer
+	var err error
+
+	answer.Name, err = readDomainName(reader)
+	if err != nil {
+		return answer, fmt.Errorf("failed to read answer name: %v", err)
+	}
+
+	if err := binary.Read(reader, binary.BigEndian, &answer.Type); err != nil {
+		return answer, fmt.Errorf("failed to read answer type: %v", err)
+	}
+
+	if err := binary.Read(reader, binary.BigEndian, &answer.Class); err != nil {
+		return answer, fmt.Errorf("failed to read answer class: %v", err)
+	}
+
+	if err := binary.Read(reader, binary.BigEndian, &answer.TTL); err != nil {
+		return answer, fmt.Errorf("failed to read TTL: %v", err)
+	}
+
+	if err := binary.Read(reader, binary.BigEndian, &answer.RDLength); err != nil {
+		return answer, fmt.Errorf("failed to read RDLength: %v", err)
+	}
+
+	if int(answer.RDLength) > reader.Len() {
+		return answer, fmt.Errorf("RDLength %d overruns message", answer.RDLength)
+	}
+
+	// Types without a typed RDATA are kept as raw octets (RFC 3597)
+	newData, ok := rdataTypes[answer.Type]
+	if !ok {
+		newData = func() RData { return &UnknownRecord{RRType: answer.Type} }
+	}
+
+	start := reader.Len()
+	answer.Data = newData()
+	if err := answer.Data.unpack(reader, int(answer.RDLength)); err != nil {
+		return answer, fmt.Errorf("failed to read %s RData: %v", TypeToString(answer.Type), err)
+	}
+	if consumed := start - reader.Len(); consumed != int(answer.RDLength) {
+		return answer, fmt.Errorf("%s RData used %d octets, RDLength is %d", TypeToString(answer.Type), consumed, answer.RDLength)
+	}
+
+	return answer, nil
 }
 
 func WriteDNSAnswer(buffer *bytes.Buffer, answer DNSAnswer) error {
-	if _, err := buffer.Write(answer.Name); err != nil {
+	return NewMessageWriter(buffer).WriteAnswer(answer)
+}
+
+func (w *MessageWriter) WriteAnswer(answer DNSAnswer) error {
+	if err := w.WriteName(answer.Name); err != nil {
 		return fmt.Errorf("failed to write answer name: %v", err)
 	}
 
-	if err := binary.Write(buffer, binary.BigEndian, answer.Type); err != nil {
+	if err := binary.Write(w.buffer, binary.BigEndian, answer.Type); err != nil {
 		return fmt.Errorf("failed to write answer type: %v", err)
 	}
 
-	if err := binary.Write(buffer, binary.BigEndian, answer.Class); err != nil {
+	if err := binary.Write(w.buffer, binary.BigEndian, answer.Class); err != nil {
 		return fmt.Errorf("failed to write answer class: %v", err)
 	}
 
-	if err := binary.Write(buffer, binary.BigEndian, answer.TTL); err != nil {
+	if err := binary.Write(w.buffer, binary.BigEndian, answer.TTL); err != nil {
 		return fmt.Errorf("failed to write TTL: %v", err)
 	}
 
-	if err := binary.Write(buffer, binary.BigEndian, answer.RDLength); err != nil {
-		return fmt.Errorf("failed to write RDLength: %v", err)
-	}
+	// RDLength is filled in once the RDATA has been written
+	lengthOffset := w.buffer.Len()
+	w.buffer.Write([]byte{0, 0})
 
-	if _, err := buffer.Write(answer.RData); err != nil {
+	if answer.Data != nil {
+		if err := answer.Data.pack(w); err != nil {
+			return fmt.Errorf("failed to write RData: %v", err)
+		}
+	} else if _, err := w.buffer.Write(answer.RData); err != nil {
 		return fmt.Errorf("failed to write RData: %v", err)
 	}
 
+	rdLength := w.buffer.Len() - lengthOffset - 2
+	if rdLength > 0xFFFF {
+		return fmt.Errorf("RData exceeds 65535 octets")
+	}
+	binary.BigEndian.PutUint16(w.buffer.Bytes()[lengthOffset:], uint16(rdLength))
+
 	return nil
 }
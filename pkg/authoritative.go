@@ -0,0 +1,218 @@
+package dns
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// maxCNAMEChain bounds how many CNAMEs inside the zone are followed for one
+// query, which also stops loops.
+const maxCNAMEChain = 8
+
+// Zone answers queries authoritatively from the records of one zone. Names
+// that do not exist get NXDOMAIN and names without the requested type get
+// NODATA, both with the zone's SOA in the authority section (RFC 2308).
+// Wildcards (RFC 4592) are expanded and NS records below the apex are
+// answered with a referral. Only queries for the zone's class, or ANY, are
+// answered.
+type Zone struct {
+	Origin []byte
+
+	class uint16
+	soa   DNSAnswer
+	nodes map[string]map[uint16][]DNSAnswer
+}
+
+// NewZone indexes records, which must all lie inside origin, share one class
+// and include exactly one SOA record at the apex.
+func NewZone(origin string, records []DNSAnswer) (*Zone, error) {
+	name, err := ParseName(origin)
+	if err != nil {
+		return nil, fmt.Errorf("invalid zone %q: %v", origin, err)
+	}
+
+	zone := &Zone{Origin: name, nodes: make(map[string]map[uint16][]DNSAnswer)}
+	apex := canonicalName(name)
+	hasSOA := false
+
+	for _, record := range records {
+		suffixes := nameSuffixes(canonicalName(record.Name))
+		inside := slices.Index(suffixes, apex)
+		if inside < 0 {
+			return nil, fmt.Errorf("%s is outside zone %s", NameToString(record.Name), NameToString(name))
+		}
+
+		if record.Type == TypeSOA {
+			if inside != 0 {
+				return nil, fmt.Errorf("SOA record for %s is not at the zone apex", NameToString(record.Name))
+			}
+			if hasSOA {
+				return nil, fmt.Errorf("zone %s has more than one SOA record", NameToString(name))
+			}
+			if _, ok := record.Data.(*SOARecord); !ok {
+				return nil, fmt.Errorf("SOA record for %s has no RDATA", NameToString(record.Name))
+			}
+			zone.soa, hasSOA = record, true
+		}
+
+		// Every name between the record and the apex exists, even if it owns
+		// no records itself (an empty non-terminal)
+		for _, suffix := range suffixes[:inside+1] {
+			if zone.nodes[suffix] == nil {
+				zone.nodes[suffix] = make(map[uint16][]DNSAnswer)
+			}
+		}
+		node := zone.nodes[suffixes[0]]
+		node[record.Type] = append(node[record.Type], record)
+	}
+
+	if !hasSOA {
+		return nil, fmt.Errorf("zone %s has no SOA record", NameToString(name))
+	}
+
+	// The SOA sets the class; RRsets of other classes would be mixed in with it
+	zone.class = zone.soa.Class
+	for _, record := range records {
+		if record.Class != zone.class {
+			return nil, fmt.Errorf("%s %s record is class %s, but zone %s is %s", NameToString(record.Name),
+				TypeToString(record.Type), ClassToString(record.Class), NameToString(name), ClassToString(zone.class))
+		}
+	}
+	return zone, nil
+}
+
+// LoadZone parses a zone file and indexes its records.
+func LoadZone(filename, origin string) (*Zone, error) {
+	records, err := ParseZoneFile(filename, origin)
+	if err != nil {
+		return nil, err
+	}
+	return NewZone(origin, records)
+}
+
+func (z *Zone) ServeDNS(w ResponseWriter, r *Message) {
+	if len(r.Question) == 0 {
+		refuse(w, r, EDEOther, "query has no question")
+		return
+	}
+	if qclass := r.Question[0].QClass; qclass != z.class && qclass != ClassANY {
+		refuse(w, r, EDENotAuthoritative, "no zone configured for this class")
+		return
+	}
+
+	var response Message
+	response.SetReply(r, true, false)
+	if !z.answer(&response, r.Question[0].QName, r.Question[0].QType, 0) {
+		refuse(w, r, EDENotAuthoritative, "name is outside the zone")
+		return
+	}
+	w.WriteMsg(&response)
+}
+
+// answer adds what the zone knows about name and qtype to response. It
+// returns false, leaving response alone, when name is outside the zone.
+func (z *Zone) answer(response *Message, name []byte, qtype uint16, chain int) bool {
+	suffixes := nameSuffixes(canonicalName(name))
+	apex := slices.Index(suffixes, canonicalName(z.Origin))
+	if apex < 0 {
+		return false
+	}
+
+	// Below a delegation the zone is not authoritative, so refer instead
+	for i := apex - 1; i >= 0; i-- {
+		if delegation := z.nodes[suffixes[i]][TypeNS]; delegation != nil {
+			z.refer(response, delegation)
+			return true
+		}
+	}
+
+	node, exists := z.nodes[suffixes[0]]
+	var owner []byte
+	if !exists {
+		// A wildcard child of the closest existing ancestor stands in for the
+		// missing name
+		for _, suffix := range suffixes[1 : apex+1] {
+			if _, ok := z.nodes[suffix]; ok {
+				node, exists = z.nodes["\x01*"+suffix]
+				owner = name
+				break
+			}
+		}
+	}
+	if !exists {
+		response.SetRCode(RCodeNXDomain)
+		z.negative(response)
+		return true
+	}
+
+	switch {
+	case qtype == TypeANY && len(node) > 0:
+		for _, rrtype := range slices.Sorted(maps.Keys(node)) {
+			response.Answer = appendRRset(response.Answer, node[rrtype], owner)
+		}
+	case node[qtype] != nil:
+		response.Answer = appendRRset(response.Answer, node[qtype], owner)
+	case node[TypeCNAME] != nil:
+		cname := node[TypeCNAME][0]
+		response.Answer = appendRRset(response.Answer, node[TypeCNAME][:1], owner)
+		// Targets in other zones are left for the client to resolve
+		if target, ok := cname.Data.(*CNAMERecord); ok && chain < maxCNAMEChain {
+			z.answer(response, target.Target, qtype, chain+1)
+		}
+	default:
+		z.negative(response)
+	}
+	return true
+}
+
+// negative adds the SOA that lets resolvers cache a negative answer. Its TTL
+// is the smaller of the SOA's own TTL and its MINIMUM field (RFC 2308
+// section 3).
+func (z *Zone) negative(response *Message) {
+	soa := z.soa
+	soa.TTL = min(soa.TTL, soa.Data.(*SOARecord).Minimum)
+	response.Authority = append(response.Authority, soa)
+}
+
+// refer points the client at the name servers of a child zone, with the
+// addresses of any that lie inside this zone as glue.
+func (z *Zone) refer(response *Message, delegation []DNSAnswer) {
+	response.Flags.AA = false
+	response.Authority = append(response.Authority, delegation...)
+	for _, record := range delegation {
+		ns, ok := record.Data.(*NSRecord)
+		if !ok {
+			continue
+		}
+		glue := z.nodes[canonicalName(ns.Host)]
+		response.Additional = append(response.Additional, glue[TypeA]...)
+		response.Additional = append(response.Additional, glue[TypeAAAA]...)
+	}
+}
+
+// appendRRset appends rrset to records, renamed to owner when a wildcard was
+// expanded.
+func appendRRset(records, rrset []DNSAnswer, owner []byte) []DNSAnswer {
+	for _, record := range rrset {
+		if owner != nil {
+			record.Name = owner
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// nameSuffixes lists a canonical name followed by each of its ancestors, up
+// to and including the root.
+func nameSuffixes(key string) []string {
+	var suffixes []string
+	for i := 0; i < len(key); {
+		suffixes = append(suffixes, key[i:])
+		if key[i] == 0 {
+			break
+		}
+		i += int(key[i]) + 1
+	}
+	return suffixes
+}
@@ -1,62 +1,148 @@
 package dns
 
 import (
-	"bytes"
 	"fmt"
 	"net"
 )
 
-func HandleDnsRequest(udpConn *net.UDPConn, source *net.UDPAddr, requestBuffer []byte) []byte {
-	reader := bytes.NewReader(requestBuffer)
+const headerLength = 12
 
-	queryHeader, err := ReadDNSHeader(reader)
-	if err != nil {
-		fmt.Println(err)
+// HandleDnsRequest passes a query to handler and returns the packed response,
+// or nil when the packet should be dropped without a reply. Malformed queries,
+// unsupported opcodes and EDNS errors are answered without calling handler.
+func HandleDnsRequest(handler Handler, local, source net.Addr, requestBuffer []byte) []byte {
+	server := &Server{Handler: handler}
+	return server.handlePacket(local, source, requestBuffer, false)
+}
+
+// handlePacket answers one query. encrypted reports whether it arrived over
+// TLS, which changes the padding policy.
+func (s *Server) handlePacket(local, source net.Addr, requestBuffer []byte, encrypted bool) []byte {
+	if len(requestBuffer) < headerLength {
 		return nil
 	}
 
-	reader.Seek(12, 0)
+	var query Message
+	var response Message
 
-	queryQuestion, err := ReadDNSQuestion(reader)
-	if err != nil {
-		fmt.Println(err)
+	if err := query.Unpack(requestBuffer); err != nil {
+		// Whatever was parsed before the error is echoed back, without EDNS.
+		// Anyone can send these, so they are counted rather than logged.
+		s.malformed.Add(1)
+		query.EDNS = nil
+		if query.Flags.QR {
+			return nil
+		}
+		response.SetReply(&query, s.Authoritative, s.RecursionAvailable)
+		response.SetRCode(RCodeFormErr)
+		return s.finishResponse(&query, &response, source)
+	}
+
+	// Never answer responses, which could start a loop between servers
+	if query.Flags.QR {
 		return nil
 	}
 
-	var responseBuffer = new(bytes.Buffer)
+	response.SetReply(&query, s.Authoritative, s.RecursionAvailable)
 
-	responseHeader := DNSHeader{
-		ID:      queryHeader.ID,
-		Flags:   MarshalFlags(UnmarshalFlags(requestBuffer[2:4])),
-		QDCount: 1,
-		ANCount: 1,
-		NSCount: 0,
-		ARCount: 0,
+	switch {
+	case !s.edns().respond(&query, &response, source, encrypted):
+	case query.Flags.OpCode != OpCodeQuery:
+		response.SetRCode(RCodeNotImp)
+		response.SetExtendedError(EDENotSupported, fmt.Sprintf("opcode %d is not supported", query.Flags.OpCode))
+	case len(query.Question) != 1:
+		response.SetRCode(RCodeFormErr)
+		response.SetExtendedError(EDEOther, "query must contain exactly one question")
+	default:
+		writer := &responseWriter{local: local, remote: source}
+		s.handler().ServeDNS(writer, &query)
+		if writer.response == nil {
+			return nil
+		}
+		s.adoptResponse(&query, &response, writer.response)
+		response = *writer.response
 	}
 
-	if err := WriteDNSHeader(responseBuffer, responseHeader); err != nil {
-		fmt.Println(err)
-		return nil
+	return s.finishResponse(&query, &response, source)
+}
+
+// adoptResponse makes a handler's message safe to send: it always answers
+// the query's ID, and carries EDNS only when the query did, merged with the
+// server's own options from template. OPCODE, RD and CD are copied from the
+// query and RA follows the server's configuration. AA is left to the
+// handler, which knows whether it answered from its own zone.
+func (s *Server) adoptResponse(query, template, handled *Message) {
+	handled.ID = query.ID
+	handled.Flags.QR = true
+	handled.Flags.OpCode = query.Flags.OpCode
+	handled.Flags.RD = query.Flags.RD
+	handled.Flags.CD = query.Flags.CD
+	handled.Flags.RA = s.RecursionAvailable
+	handled.Flags.Z = 0
+
+	if query.EDNS == nil {
+		handled.EDNS = nil
+		return
+	}
+	if handled.EDNS == nil {
+		handled.EDNS = &EDNS{DO: query.EDNS.DO}
 	}
 
-	if err := WriteDNSQuestion(responseBuffer, queryQuestion); err != nil {
-		fmt.Println(err)
-		return nil
+	rcode := handled.RCode()
+	handled.EDNS.UDPSize = template.EDNS.UDPSize
+	handled.EDNS.Version = EDNSVersion
+	for _, option := range template.EDNS.Options {
+		if handled.EDNS.Option(option.Code()) == nil {
+			handled.EDNS.Options = append(handled.EDNS.Options, option)
+		}
 	}
+	handled.SetRCode(rcode)
+}
 
-	answer := DNSAnswer{
-		Name:     queryQuestion.QName,
-		Type:     1,
-		Class:    1,
-		TTL:      60,
-		RDLength: 4,
-		RData:    []byte{0x08, 0x08, 0x08, 0x08},
+func (s *Server) finishResponse(query, response *Message, source net.Addr) []byte {
+	size := MaxMessageSize
+	if isUDP(source) {
+		size = s.edns().udpSize(query)
 	}
 
-	if err := WriteDNSAnswer(responseBuffer, answer); err != nil {
-		fmt.Println(err)
-		return nil
+	responseBuffer, err := response.Truncate(size)
+	if err != nil {
+		fmt.Println("Failed to pack response:", err)
+		return serverFailure(query, response)
+	}
+
+	if responseBuffer, err = s.edns().pad(response, responseBuffer, size); err != nil {
+		fmt.Println("Failed to pad response:", err)
+		return serverFailure(query, response)
+	}
+
+	return responseBuffer
+}
+
+// serverFailure replaces a response that could not be packed with a bare
+// SERVFAIL, keeping only the header, question and a fresh OPT record.
+func serverFailure(query, response *Message) []byte {
+	failure := Message{
+		ID:       response.ID,
+		Flags:    response.Flags,
+		Question: response.Question,
+	}
+	failure.Flags.TC = false
+
+	if response.EDNS != nil {
+		failure.EDNS = &EDNS{UDPSize: response.EDNS.UDPSize, Version: EDNSVersion, DO: response.EDNS.DO}
 	}
+	failure.SetRCode(RCodeServFail)
+	failure.SetExtendedError(EDEOther, "internal server error")
 
-	return responseBuffer.Bytes()
+	responseBuffer, err := failure.Pack()
+	if err != nil {
+		// The question itself may be what failed to pack
+		failure.Question = nil
+		if responseBuffer, err = failure.Pack(); err != nil {
+			fmt.Println("Failed to pack SERVFAIL response:", err)
+			return nil
+		}
+	}
+	return responseBuffer
 }
@@ -0,0 +1,253 @@
+package dns
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	DoHMediaType  = "application/dns-message"
+	JSONMediaType = "application/dns-json"
+)
+
+// DoHHandler serves DNS over HTTPS (RFC 8484): GET requests carry the query
+// base64url encoded in the dns parameter and POST requests carry it as the
+// body. Queries are answered by Server exactly as over UDP and TCP. With
+// JSON set, GET requests with a name parameter get the JSON format offered
+// by public resolvers instead.
+type DoHHandler struct {
+	// Server answers the queries; nil uses a zero Server.
+	Server *Server
+	JSON   bool
+}
+
+func (h *DoHHandler) server() *Server {
+	if h.Server != nil {
+		return h.Server
+	}
+	return &Server{}
+}
+
+func (h *DoHHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var requestBuffer []byte
+
+	switch r.Method {
+	case http.MethodGet:
+		if h.JSON && r.URL.Query().Has("name") {
+			h.serveJSON(w, r)
+			return
+		}
+
+		encoded := r.URL.Query().Get("dns")
+		if encoded == "" {
+			http.Error(w, "missing dns parameter", http.StatusBadRequest)
+			return
+		}
+		// Padding is not allowed, but tolerating it costs nothing
+		decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+		if err != nil {
+			http.Error(w, "dns parameter is not base64url", http.StatusBadRequest)
+			return
+		}
+		requestBuffer = decoded
+	case http.MethodPost:
+		if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != DoHMediaType {
+			http.Error(w, "content type must be "+DoHMediaType, http.StatusUnsupportedMediaType)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, MaxMessageSize+1))
+		if err != nil {
+			http.Error(w, "failed to read body", http.StatusBadRequest)
+			return
+		}
+		if len(body) > MaxMessageSize {
+			http.Error(w, "query too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		requestBuffer = body
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	response, responseBuffer, ok := h.exchange(w, r, requestBuffer)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", DoHMediaType)
+	w.Header().Set("Cache-Control", cacheControl(response))
+	w.Write(responseBuffer)
+}
+
+// exchange answers requestBuffer and writes an HTTP error itself when there
+// is no DNS response to send.
+func (h *DoHHandler) exchange(w http.ResponseWriter, r *http.Request, requestBuffer []byte) (*Message, []byte, bool) {
+	if len(requestBuffer) < headerLength {
+		http.Error(w, "query too short", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	local, _ := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	remote := httpRemoteAddr(r)
+
+	responseBuffer := h.server().handlePacket(local, remote, requestBuffer, r.TLS != nil)
+	if responseBuffer == nil {
+		http.Error(w, "no response", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	var response Message
+	if err := response.Unpack(responseBuffer); err != nil {
+		http.Error(w, "malformed response", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	return &response, responseBuffer, true
+}
+
+// cacheControl lets HTTP caches keep a response no longer than its records
+// (RFC 8484 section 5.1). Negative answers use the SOA's negative TTL.
+func cacheControl(response *Message) string {
+	maxAge := -1
+	for _, record := range response.Answer {
+		if maxAge < 0 || int(record.TTL) < maxAge {
+			maxAge = int(record.TTL)
+		}
+	}
+	if maxAge < 0 {
+		for _, record := range response.Authority {
+			if soa, ok := record.Data.(*SOARecord); ok {
+				maxAge = int(min(record.TTL, soa.Minimum))
+			}
+		}
+	}
+	if maxAge < 0 {
+		maxAge = 0
+	}
+	return fmt.Sprintf("max-age=%d", maxAge)
+}
+
+func httpRemoteAddr(r *http.Request) net.Addr {
+	host, port, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return nil
+	}
+	portNumber, _ := strconv.Atoi(port)
+	return &net.TCPAddr{IP: net.ParseIP(host), Port: portNumber}
+}
+
+type jsonQuestion struct {
+	Name string `json:"name"`
+	Type uint16 `json:"type"`
+}
+
+type jsonRecord struct {
+	Name string `json:"name"`
+	Type uint16 `json:"type"`
+	TTL  uint32 `json:"TTL"`
+	Data string `json:"data"`
+}
+
+type jsonResponse struct {
+	Status    uint16         `json:"Status"`
+	TC        bool           `json:"TC"`
+	RD        bool           `json:"RD"`
+	RA        bool           `json:"RA"`
+	AD        bool           `json:"AD"`
+	CD        bool           `json:"CD"`
+	Question  []jsonQuestion `json:"Question"`
+	Answer    []jsonRecord   `json:"Answer,omitempty"`
+	Authority []jsonRecord   `json:"Authority,omitempty"`
+	Comment   string         `json:"Comment,omitempty"`
+}
+
+// serveJSON answers ?name=example.com&type=AAAA style queries. type may be a
+// mnemonic or a number and defaults to A; do and cd set the matching bits.
+func (h *DoHHandler) serveJSON(w http.ResponseWriter, r *http.Request) {
+	parameters := r.URL.Query()
+
+	name, err := ParseName(parameters.Get("name"))
+	if err != nil {
+		http.Error(w, "invalid name", http.StatusBadRequest)
+		return
+	}
+
+	qtype := TypeA
+	if value := parameters.Get("type"); value != "" {
+		if number, err := strconv.ParseUint(value, 10, 16); err == nil {
+			qtype = uint16(number)
+		} else if qtype, err = StringToType(value); err != nil {
+			http.Error(w, "invalid type", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// EDNS lets extended errors come back as the comment
+	query := Message{
+		Flags:    Flags{RD: true, CD: jsonFlag(parameters.Get("cd"))},
+		Question: []DNSQuestion{{QName: name, QType: qtype, QClass: ClassIN}},
+		EDNS:     &EDNS{UDPSize: DefaultUDPSize, DO: jsonFlag(parameters.Get("do"))},
+	}
+	requestBuffer, err := query.Pack()
+	if err != nil {
+		http.Error(w, "invalid query", http.StatusBadRequest)
+		return
+	}
+
+	response, _, ok := h.exchange(w, r, requestBuffer)
+	if !ok {
+		return
+	}
+
+	result := jsonResponse{
+		Status:    response.RCode(),
+		TC:        response.Flags.TC,
+		RD:        response.Flags.RD,
+		RA:        response.Flags.RA,
+		AD:        response.Flags.AD,
+		CD:        response.Flags.CD,
+		Answer:    jsonRecords(response.Answer),
+		Authority: jsonRecords(response.Authority),
+	}
+	for _, question := range response.Question {
+		result.Question = append(result.Question, jsonQuestion{Name: NameToString(question.QName), Type: question.QType})
+	}
+	var comments []string
+	for _, extended := range response.ExtendedErrors() {
+		comments = append(comments, extended.String())
+	}
+	result.Comment = strings.Join(comments, "; ")
+
+	w.Header().Set("Content-Type", JSONMediaType)
+	w.Header().Set("Cache-Control", cacheControl(response))
+	json.NewEncoder(w).Encode(result)
+}
+
+func jsonRecords(records []DNSAnswer) []jsonRecord {
+	var converted []jsonRecord
+	for _, record := range records {
+		data := ""
+		if record.Data != nil {
+			data = record.Data.String()
+		}
+		converted = append(converted, jsonRecord{
+			Name: NameToString(record.Name),
+			Type: record.Type,
+			TTL:  record.TTL,
+			Data: data,
+		})
+	}
+	return converted
+}
+
+func jsonFlag(value string) bool {
+	return value == "1" || strings.EqualFold(value, "true")
+}
@@ -0,0 +1,126 @@
+package dns
+
+import (
+	"encoding/binary"
+	"fmt"
+	"unicode/utf8"
+)
+
+const (
+	EDEOther                      uint16 = 0
+	EDEUnsupportedDNSKEYAlgorithm uint16 = 1
+	EDEUnsupportedDSDigestType    uint16 = 2
+	EDEStaleAnswer                uint16 = 3
+	EDEForgedAnswer               uint16 = 4
+	EDEDNSSECIndeterminate        uint16 = 5
+	EDEDNSSECBogus                uint16 = 6
+	EDESignatureExpired           uint16 = 7
+	EDESignatureNotYetValid       uint16 = 8
+	EDEDNSKEYMissing              uint16 = 9
+	EDERRSIGsMissing              uint16 = 10
+	EDENoZoneKeyBitSet            uint16 = 11
+	EDENSECMissing                uint16 = 12
+	EDECachedError                uint16 = 13
+	EDENotReady                   uint16 = 14
+	EDEBlocked                    uint16 = 15
+	EDECensored                   uint16 = 16
+	EDEFiltered                   uint16 = 17
+	EDEProhibited                 uint16 = 18
+	EDEStaleNXDomainAnswer        uint16 = 19
+	EDENotAuthoritative           uint16 = 20
+	EDENotSupported               uint16 = 21
+	EDENoReachableAuthority       uint16 = 22
+	EDENetworkError               uint16 = 23
+	EDEInvalidData                uint16 = 24
+)
+
+var edeNames = map[uint16]string{
+	EDEOther:                      "Other Error",
+	EDEUnsupportedDNSKEYAlgorithm: "Unsupported DNSKEY Algorithm",
+	EDEUnsupportedDSDigestType:    "Unsupported DS Digest Type",
+	EDEStaleAnswer:                "Stale Answer",
+	EDEForgedAnswer:               "Forged Answer",
+	EDEDNSSECIndeterminate:        "DNSSEC Indeterminate",
+	EDEDNSSECBogus:                "DNSSEC Bogus",
+	EDESignatureExpired:           "Signature Expired",
+	EDESignatureNotYetValid:       "Signature Not Yet Valid",
+	EDEDNSKEYMissing:              "DNSKEY Missing",
+	EDERRSIGsMissing:              "RRSIGs Missing",
+	EDENoZoneKeyBitSet:            "No Zone Key Bit Set",
+	EDENSECMissing:                "NSEC Missing",
+	EDECachedError:                "Cached Error",
+	EDENotReady:                   "Not Ready",
+	EDEBlocked:                    "Blocked",
+	EDECensored:                   "Censored",
+	EDEFiltered:                   "Filtered",
+	EDEProhibited:                 "Prohibited",
+	EDEStaleNXDomainAnswer:        "Stale NXDomain Answer",
+	EDENotAuthoritative:           "Not Authoritative",
+	EDENotSupported:               "Not Supported",
+	EDENoReachableAuthority:       "No Reachable Authority",
+	EDENetworkError:               "Network Error",
+	EDEInvalidData:                "Invalid Data",
+}
+
+type ExtendedErrorOption struct {
+	InfoCode  uint16
+	ExtraText string
+}
+
+func (o *ExtendedErrorOption) Code() uint16 { return OptionCodeEDE }
+
+func (o *ExtendedErrorOption) Pack() ([]byte, error) {
+	if !utf8.ValidString(o.ExtraText) {
+		return nil, fmt.Errorf("extra text must be UTF-8")
+	}
+	data := binary.BigEndian.AppendUint16(nil, o.InfoCode)
+	return append(data, o.ExtraText...), nil
+}
+
+func (o *ExtendedErrorOption) Unpack(data []byte) error {
+	if len(data) < 2 {
+		return fmt.Errorf("extended error option too short")
+	}
+	o.InfoCode = binary.BigEndian.Uint16(data)
+	// Some senders NUL-terminate the text, which RFC 8914 says to ignore
+	text := data[2:]
+	if n := len(text); n > 0 && text[n-1] == 0 {
+		text = text[:n-1]
+	}
+	o.ExtraText = string(text)
+	return nil
+}
+
+func (o *ExtendedErrorOption) String() string {
+	name, ok := edeNames[o.InfoCode]
+	if !ok {
+		name = fmt.Sprintf("Info Code %d", o.InfoCode)
+	}
+	if o.ExtraText == "" {
+		return fmt.Sprintf("EDE %d (%s)", o.InfoCode, name)
+	}
+	return fmt.Sprintf("EDE %d (%s): %s", o.InfoCode, name, o.ExtraText)
+}
+
+// SetExtendedError attaches an Extended DNS Error to the response. It is a
+// no-op for messages without EDNS, as an OPT record may only be returned to
+// clients that sent one.
+func (m *Message) SetExtendedError(infoCode uint16, extraText string) {
+	if m.EDNS == nil {
+		return
+	}
+	m.EDNS.Options = append(m.EDNS.Options, &ExtendedErrorOption{InfoCode: infoCode, ExtraText: extraText})
+}
+
+func (m *Message) ExtendedErrors() []*ExtendedErrorOption {
+	if m.EDNS == nil {
+		return nil
+	}
+	var errors []*ExtendedErrorOption
+	for _, option := range m.EDNS.Options {
+		if ede, ok := option.(*ExtendedErrorOption); ok {
+			errors = append(errors, ede)
+		}
+	}
+	return errors
+}
@@ -0,0 +1,310 @@
+package dns
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	EDNSVersion    uint8  = 0
+	DefaultUDPSize uint16 = 1232
+)
+
+type EDNS struct {
+	UDPSize       uint16
+	ExtendedRCODE uint8
+	Version       uint8
+	DO            bool
+	Options       []EDNSOption
+}
+
+type EDNSOption interface {
+	Code() uint16
+	Pack() ([]byte, error)
+	Unpack(data []byte) error
+}
+
+type UnknownOption struct {
+	OptionCode uint16
+	Data       []byte
+}
+
+func (o *UnknownOption) Code() uint16 { return o.OptionCode }
+
+func (o *UnknownOption) Pack() ([]byte, error) { return o.Data, nil }
+
+func (o *UnknownOption) Unpack(data []byte) error {
+	o.Data = append([]byte(nil), data...)
+	return nil
+}
+
+type OPTRecord struct {
+	Options []EDNSOption
+}
+
+func (r *OPTRecord) Type() uint16 { return TypeOPT }
+
+func (r *OPTRecord) String() string {
+	codes := make([]string, len(r.Options))
+	for i, option := range r.Options {
+		codes[i] = fmt.Sprintf("%d", option.Code())
+	}
+	return "options=" + strings.Join(codes, ",")
+}
+
+func (r *OPTRecord) pack(w *MessageWriter) error {
+	for _, option := range r.Options {
+		data, err := option.Pack()
+		if err != nil {
+			return fmt.Errorf("failed to pack EDNS option %d: %v", option.Code(), err)
+		}
+		if len(data) > 0xFFFF {
+			return fmt.Errorf("EDNS option %d exceeds 65535 octets", option.Code())
+		}
+		binary.Write(w.buffer, binary.BigEndian, []uint16{option.Code(), uint16(len(data))})
+		w.buffer.Write(data)
+	}
+	return nil
+}
+
+func (r *OPTRecord) unpack(reader *bytes.Reader, length int) error {
+	r.Options = nil
+	for length > 0 {
+		var header [2]uint16
+		if length < 4 {
+			return fmt.Errorf("truncated EDNS option header")
+		}
+		if err := binary.Read(reader, binary.BigEndian, &header); err != nil {
+			return err
+		}
+		length -= 4
+
+		if int(header[1]) > length {
+			return fmt.Errorf("EDNS option %d overruns RDATA", header[0])
+		}
+		data := make([]byte, header[1])
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return err
+		}
+		length -= len(data)
+
+		option := newEDNSOption(header[0])
+		if err := option.Unpack(data); err != nil {
+			return fmt.Errorf("failed to read EDNS option %d: %v", header[0], err)
+		}
+		r.Options = append(r.Options, option)
+	}
+	return nil
+}
+
+func (e *EDNS) Option(code uint16) EDNSOption {
+	for _, option := range e.Options {
+		if option.Code() == code {
+			return option
+		}
+	}
+	return nil
+}
+
+// record encodes the OPT pseudo-RR (RFC 6891 section 6.1.2): CLASS carries the
+// UDP payload size and TTL carries the extended RCODE, version and DO bit.
+func (e *EDNS) record() DNSAnswer {
+	ttl := uint32(e.ExtendedRCODE)<<24 | uint32(e.Version)<<16
+	if e.DO {
+		ttl |= 1 << 15
+	}
+	return DNSAnswer{
+		Name:  []byte{0},
+		Type:  TypeOPT,
+		Class: e.UDPSize,
+		TTL:   ttl,
+		Data:  &OPTRecord{Options: e.Options},
+	}
+}
+
+func ednsFromRecord(record DNSAnswer) (*EDNS, error) {
+	if len(record.Name) != 1 || record.Name[0] != 0 {
+		return nil, fmt.Errorf("OPT record owner must be the root")
+	}
+	opt, ok := record.Data.(*OPTRecord)
+	if !ok {
+		return nil, fmt.Errorf("malformed OPT record")
+	}
+	return &EDNS{
+		UDPSize:       record.Class,
+		ExtendedRCODE: uint8(record.TTL >> 24),
+		Version:       uint8(record.TTL >> 16),
+		DO:            record.TTL&(1<<15) != 0,
+		Options:       opt.Options,
+	}, nil
+}
+
+func (m *Message) RCode() uint16 {
+	rcode := uint16(m.Flags.RCODE)
+	if m.EDNS != nil {
+		rcode |= uint16(m.EDNS.ExtendedRCODE) << 4
+	}
+	return rcode
+}
+
+// SetRCode splits rcode between the header and the OPT record. Extended codes
+// above 15 are only representable when the message carries EDNS.
+func (m *Message) SetRCode(rcode uint16) {
+	m.Flags.RCODE = uint8(rcode & 0x0F)
+	if m.EDNS != nil {
+		m.EDNS.ExtendedRCODE = uint8(rcode >> 4)
+	}
+}
+
+type EDNSConfig struct {
+	UDPSize          uint16
+	NSID             []byte
+	Cookies          *CookieGenerator
+	PaddingBlockSize int
+	KeepaliveTimeout time.Duration
+}
+
+var DefaultEDNSConfig = &EDNSConfig{
+	UDPSize:          DefaultUDPSize,
+	Cookies:          mustCookieGenerator(),
+	PaddingBlockSize: 468,
+	KeepaliveTimeout: 30 * time.Second,
+}
+
+func mustCookieGenerator() *CookieGenerator {
+	generator, err := NewCookieGenerator()
+	if err != nil {
+		panic(fmt.Sprintf("failed to create cookie secret: %v", err))
+	}
+	return generator
+}
+
+// respond adds the server's OPT record and options to response when the query
+// used EDNS and reports whether the query can be answered normally.
+func (c *EDNSConfig) respond(query, response *Message, source net.Addr, encrypted bool) bool {
+	if query.EDNS == nil {
+		return true
+	}
+
+	response.EDNS = &EDNS{
+		UDPSize: c.UDPSize,
+		Version: EDNSVersion,
+		DO:      query.EDNS.DO,
+	}
+
+	if query.EDNS.Version > EDNSVersion {
+		response.Answer = nil
+		response.Authority = nil
+		response.Additional = nil
+		response.SetRCode(RCodeBadVers)
+		response.SetExtendedError(EDEOther, fmt.Sprintf("EDNS version %d is not supported", query.EDNS.Version))
+		return false
+	}
+
+	if cookie, ok := query.EDNS.Option(OptionCodeCookie).(*CookieOption); ok && c.Cookies != nil {
+		ip := addrIP(source)
+		server := cookie.Server
+		valid, refresh := false, true
+		if len(server) > 0 {
+			valid, refresh = c.Cookies.Validate(cookie.Client, server, ip)
+		}
+		if refresh {
+			server = c.Cookies.Generate(cookie.Client, ip)
+		}
+		response.EDNS.Options = append(response.EDNS.Options, &CookieOption{Client: cookie.Client, Server: server})
+
+		// A stale or forged server cookie over UDP is answered with BADCOOKIE so
+		// the client retries with the fresh cookie (RFC 7873 section 5.2.3)
+		if len(cookie.Server) > 0 && !valid && isUDP(source) {
+			response.Answer = nil
+			response.Authority = nil
+			response.Additional = nil
+			response.SetRCode(RCodeBadCookie)
+			response.SetExtendedError(EDEOther, "server cookie is invalid or expired")
+			return false
+		}
+	}
+
+	if query.EDNS.Option(OptionCodeNSID) != nil && len(c.NSID) > 0 {
+		response.EDNS.Options = append(response.EDNS.Options, &NSIDOption{NSID: c.NSID})
+	}
+
+	// Keepalive only has meaning on connections (RFC 7828 section 3.2.1)
+	if query.EDNS.Option(OptionCodeKeepalive) != nil && !isUDP(source) && c.KeepaliveTimeout > 0 {
+		response.EDNS.Options = append(response.EDNS.Options, &KeepaliveOption{Timeout: c.KeepaliveTimeout, HasTimeout: true})
+	}
+
+	// Padding is returned to clients that pad (RFC 7830 section 3), and always
+	// over TLS where response sizes would otherwise leak the query (RFC 8310
+	// section 9); its length is settled once the rest of the response is packed
+	if (query.EDNS.Option(OptionCodePadding) != nil || encrypted) && c.PaddingBlockSize > 0 {
+		response.EDNS.Options = append(response.EDNS.Options, &PaddingOption{})
+	}
+
+	return true
+}
+
+// pad grows the padding option so the packed response is a multiple of the
+// block size without going over limit.
+func (c *EDNSConfig) pad(response *Message, packed []byte, limit int) ([]byte, error) {
+	if response.EDNS == nil || c.PaddingBlockSize <= 0 {
+		return packed, nil
+	}
+
+	padding, ok := response.EDNS.Option(OptionCodePadding).(*PaddingOption)
+	if !ok {
+		return packed, nil
+	}
+
+	// packed already includes the four octet header of the empty option
+	length := (c.PaddingBlockSize - len(packed)%c.PaddingBlockSize) % c.PaddingBlockSize
+	if len(packed)+length > limit {
+		length = limit - len(packed)
+	}
+	if length <= 0 {
+		return packed, nil
+	}
+
+	padding.Length = length
+	return response.Pack()
+}
+
+// udpSize is the largest response the client accepts over UDP, capped at
+// what this server is willing to send.
+func (c *EDNSConfig) udpSize(query *Message) int {
+	if query.EDNS == nil || query.EDNS.UDPSize <= uint16(UDPMaxMessageSize) {
+		return int(UDPMaxMessageSize)
+	}
+	size := query.EDNS.UDPSize
+	if c.UDPSize < size {
+		size = c.UDPSize
+	}
+	if size < uint16(UDPMaxMessageSize) {
+		return int(UDPMaxMessageSize)
+	}
+	return int(size)
+}
+
+func addrIP(addr net.Addr) net.IP {
+	switch addr := addr.(type) {
+	case *net.UDPAddr:
+		if addr != nil {
+			return addr.IP
+		}
+	case *net.TCPAddr:
+		if addr != nil {
+			return addr.IP
+		}
+	}
+	return nil
+}
+
+func isUDP(addr net.Addr) bool {
+	_, ok := addr.(*net.UDPAddr)
+	return ok
+}
@@ -0,0 +1,141 @@
+package dns
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	OptionCodeNSID      uint16 = 3
+	OptionCodeCookie    uint16 = 10
+	OptionCodeKeepalive uint16 = 11
+	OptionCodePadding   uint16 = 12
+	OptionCodeEDE       uint16 = 15
+)
+
+var (
+	ednsOptionsMu sync.RWMutex
+	ednsOptions   = map[uint16]func() EDNSOption{
+		OptionCodeNSID:      func() EDNSOption { return new(NSIDOption) },
+		OptionCodeCookie:    func() EDNSOption { return new(CookieOption) },
+		OptionCodeKeepalive: func() EDNSOption { return new(KeepaliveOption) },
+		OptionCodePadding:   func() EDNSOption { return new(PaddingOption) },
+		OptionCodeEDE:       func() EDNSOption { return new(ExtendedErrorOption) },
+	}
+)
+
+// RegisterEDNSOption makes OPT records decode options with the given code
+// into the type returned by newOption instead of an UnknownOption.
+func RegisterEDNSOption(code uint16, newOption func() EDNSOption) {
+	ednsOptionsMu.Lock()
+	defer ednsOptionsMu.Unlock()
+	ednsOptions[code] = newOption
+}
+
+func newEDNSOption(code uint16) EDNSOption {
+	ednsOptionsMu.RLock()
+	newOption, ok := ednsOptions[code]
+	ednsOptionsMu.RUnlock()
+
+	if !ok {
+		return &UnknownOption{OptionCode: code}
+	}
+	return newOption()
+}
+
+type NSIDOption struct {
+	NSID []byte
+}
+
+func (o *NSIDOption) Code() uint16 { return OptionCodeNSID }
+
+func (o *NSIDOption) Pack() ([]byte, error) { return o.NSID, nil }
+
+func (o *NSIDOption) Unpack(data []byte) error {
+	o.NSID = append([]byte(nil), data...)
+	return nil
+}
+
+type CookieOption struct {
+	Client []byte
+	Server []byte
+}
+
+func (o *CookieOption) Code() uint16 { return OptionCodeCookie }
+
+func (o *CookieOption) Pack() ([]byte, error) {
+	if err := validateCookie(o.Client, o.Server); err != nil {
+		return nil, err
+	}
+	return append(append([]byte(nil), o.Client...), o.Server...), nil
+}
+
+func (o *CookieOption) Unpack(data []byte) error {
+	if len(data) < clientCookieLength {
+		return fmt.Errorf("cookie option too short")
+	}
+	o.Client = append([]byte(nil), data[:clientCookieLength]...)
+	o.Server = nil
+	if len(data) > clientCookieLength {
+		o.Server = append([]byte(nil), data[clientCookieLength:]...)
+	}
+	return validateCookie(o.Client, o.Server)
+}
+
+func validateCookie(client, server []byte) error {
+	if len(client) != clientCookieLength {
+		return fmt.Errorf("client cookie must be %d octets", clientCookieLength)
+	}
+	if len(server) != 0 && (len(server) < minServerCookieBytes || len(server) > maxServerCookieBytes) {
+		return fmt.Errorf("server cookie must be %d to %d octets", minServerCookieBytes, maxServerCookieBytes)
+	}
+	return nil
+}
+
+// KeepaliveOption carries the edns-tcp-keepalive timeout. Clients send it
+// without a timeout; servers always include one.
+type KeepaliveOption struct {
+	Timeout    time.Duration
+	HasTimeout bool
+}
+
+func (o *KeepaliveOption) Code() uint16 { return OptionCodeKeepalive }
+
+func (o *KeepaliveOption) Pack() ([]byte, error) {
+	if !o.HasTimeout {
+		return nil, nil
+	}
+	units := o.Timeout / (100 * time.Millisecond)
+	if units > 0xFFFF {
+		units = 0xFFFF
+	}
+	return binary.BigEndian.AppendUint16(nil, uint16(units)), nil
+}
+
+func (o *KeepaliveOption) Unpack(data []byte) error {
+	switch len(data) {
+	case 0:
+		o.Timeout, o.HasTimeout = 0, false
+	case 2:
+		o.Timeout = time.Duration(binary.BigEndian.Uint16(data)) * 100 * time.Millisecond
+		o.HasTimeout = true
+	default:
+		return fmt.Errorf("keepalive option must be 0 or 2 octets")
+	}
+	return nil
+}
+
+type PaddingOption struct {
+	Length int
+}
+
+func (o *PaddingOption) Code() uint16 { return OptionCodePadding }
+
+func (o *PaddingOption) Pack() ([]byte, error) { return make([]byte, o.Length), nil }
+
+func (o *PaddingOption) Unpack(data []byte) error {
+	o.Length = len(data)
+	return nil
+}
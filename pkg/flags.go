@@ -7,16 +7,37 @@ const (
 	TC_BIT     = 9
 	RD_BIT     = 8
 	RA_BIT     = 7
-	Z_POS      = 4
+	Z_POS      = 6
+	AD_BIT     = 5
+	CD_BIT     = 4
 	RCODE_POS  = 0
 )
 
 const (
 	OPCODE_MASK = 0x7800
-	Z_MASK      = 0x0070
+	Z_MASK      = 0x0040
 	RCODE_MASK  = 0x000F
 )
 
+const (
+	OpCodeQuery  uint8 = 0
+	OpCodeIQuery uint8 = 1
+	OpCodeStatus uint8 = 2
+	OpCodeNotify uint8 = 4
+	OpCodeUpdate uint8 = 5
+)
+
+const (
+	RCodeNoError   uint16 = 0
+	RCodeFormErr   uint16 = 1
+	RCodeServFail  uint16 = 2
+	RCodeNXDomain  uint16 = 3
+	RCodeNotImp    uint16 = 4
+	RCodeRefused   uint16 = 5
+	RCodeBadVers   uint16 = 16
+	RCodeBadCookie uint16 = 23
+)
+
 type Flags struct {
 	QR     bool
 	OpCode uint8
@@ -25,6 +46,8 @@ type Flags struct {
 	RD     bool
 	RA     bool
 	Z      uint8
+	AD     bool
+	CD     bool
 	RCODE  uint8
 }
 
@@ -44,31 +67,23 @@ func getField(flags uint16, mask uint16, pos int) uint8 {
 }
 
 func setField(flags uint16, value uint8, mask uint16, pos int) uint16 {
-	return (flags & ^mask) | (uint16(value) << pos)
+	return (flags & ^mask) | ((uint16(value) << pos) & mask)
 }
 
 func UnmarshalFlags(buffer []byte) Flags {
 	flags := uint16(buffer[0])<<8 | uint16(buffer[1])
 
-	opcode := getField(flags, OPCODE_MASK, OPCODE_POS)
-
-	// Get the RCODE directly from the flags
-	rcode := getField(flags, RCODE_MASK, RCODE_POS)
-
-	// Override with 4 (Not Implemented) if opcode is not standard
-	if opcode != 0 {
-		rcode = 4
-	}
-
 	return Flags{
 		QR:     getBit(flags, QR_BIT),
-		OpCode: opcode,
+		OpCode: getField(flags, OPCODE_MASK, OPCODE_POS),
 		AA:     getBit(flags, AA_BIT),
 		TC:     getBit(flags, TC_BIT),
 		RD:     getBit(flags, RD_BIT),
 		RA:     getBit(flags, RA_BIT),
 		Z:      getField(flags, Z_MASK, Z_POS),
-		RCODE:  rcode,
+		AD:     getBit(flags, AD_BIT),
+		CD:     getBit(flags, CD_BIT),
+		RCODE:  getField(flags, RCODE_MASK, RCODE_POS),
 	}
 }
 
@@ -82,7 +97,22 @@ func MarshalFlags(f Flags) uint16 {
 	flags = setBit(flags, RD_BIT, f.RD)
 	flags = setBit(flags, RA_BIT, f.RA)
 	flags = setField(flags, f.Z, Z_MASK, Z_POS)
+	flags = setBit(flags, AD_BIT, f.AD)
+	flags = setBit(flags, CD_BIT, f.CD)
 	flags = setField(flags, f.RCODE, RCODE_MASK, RCODE_POS)
 
 	return flags
 }
+
+// ResponseFlags builds the flags for a reply to query. Only OPCODE, RD and CD
+// are carried over; AA and RA describe this server, and Z is always cleared.
+func ResponseFlags(query Flags, authoritative, recursionAvailable bool) Flags {
+	return Flags{
+		QR:     true,
+		OpCode: query.OpCode,
+		AA:     authoritative,
+		RD:     query.RD,
+		RA:     recursionAvailable,
+		CD:     query.CD,
+	}
+}
@@ -0,0 +1,57 @@
+package dns
+
+import (
+	"errors"
+	"net"
+)
+
+type Handler interface {
+	ServeDNS(w ResponseWriter, r *Message)
+}
+
+type HandlerFunc func(w ResponseWriter, r *Message)
+
+func (f HandlerFunc) ServeDNS(w ResponseWriter, r *Message) {
+	f(w, r)
+}
+
+// ResponseWriter collects the reply to a query. The server packs and sends
+// the message once the handler returns; a handler that never calls WriteMsg
+// leaves the query unanswered.
+type ResponseWriter interface {
+	LocalAddr() net.Addr
+	RemoteAddr() net.Addr
+	WriteMsg(m *Message) error
+}
+
+var ErrResponseWritten = errors.New("response already written")
+
+type responseWriter struct {
+	local    net.Addr
+	remote   net.Addr
+	response *Message
+}
+
+func (w *responseWriter) LocalAddr() net.Addr {
+	return w.local
+}
+
+func (w *responseWriter) RemoteAddr() net.Addr {
+	return w.remote
+}
+
+func (w *responseWriter) WriteMsg(m *Message) error {
+	if w.response != nil {
+		return ErrResponseWritten
+	}
+	w.response = m
+	return nil
+}
+
+func refuse(w ResponseWriter, r *Message, infoCode uint16, extraText string) {
+	var response Message
+	response.SetReply(r, false, false)
+	response.SetRCode(RCodeRefused)
+	response.SetExtendedError(infoCode, extraText)
+	w.WriteMsg(&response)
+}
@@ -25,7 +25,11 @@ func ReadDNSHeader(reader *bytes.Reader) (DNSHeader, error) {
 }
 
 func WriteDNSHeader(buffer *bytes.Buffer, header DNSHeader) error {
-	err := binary.Write(buffer, binary.BigEndian, header)
+	return NewMessageWriter(buffer).WriteHeader(header)
+}
+
+func (w *MessageWriter) WriteHeader(header DNSHeader) error {
+	err := binary.Write(w.buffer, binary.BigEndian, header)
 	if err != nil {
 		return fmt.Errorf("failed to write DNS header: %v", err)
 	}
@@ -0,0 +1,141 @@
+package dns
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// MaxMessageSize is the largest message the two octet length prefix used
+// over TCP can describe.
+const MaxMessageSize = 65535
+
+type Message struct {
+	ID         uint16
+	Flags      Flags
+	Question   []DNSQuestion
+	Answer     []DNSAnswer
+	Authority  []DNSAnswer
+	Additional []DNSAnswer
+	EDNS       *EDNS
+}
+
+func (m *Message) Unpack(buffer []byte) error {
+	reader := bytes.NewReader(buffer)
+
+	header, err := ReadDNSHeader(reader)
+	if err != nil {
+		return err
+	}
+
+	m.ID = header.ID
+	m.Flags = UnmarshalFlags([]byte{byte(header.Flags >> 8), byte(header.Flags)})
+	m.Question = nil
+	m.Answer = nil
+	m.Authority = nil
+	m.Additional = nil
+	m.EDNS = nil
+
+	for i := 0; i < int(header.QDCount); i++ {
+		question, err := ReadDNSQuestion(reader)
+		if err != nil {
+			return fmt.Errorf("failed to read question %d: %v", i, err)
+		}
+		m.Question = append(m.Question, question)
+	}
+
+	if m.Answer, err = readSection(reader, header.ANCount); err != nil {
+		return fmt.Errorf("failed to read answer section: %v", err)
+	}
+
+	if m.Authority, err = readSection(reader, header.NSCount); err != nil {
+		return fmt.Errorf("failed to read authority section: %v", err)
+	}
+
+	additional, err := readSection(reader, header.ARCount)
+	if err != nil {
+		return fmt.Errorf("failed to read additional section: %v", err)
+	}
+
+	for _, record := range additional {
+		if record.Type != TypeOPT {
+			m.Additional = append(m.Additional, record)
+			continue
+		}
+		if m.EDNS != nil {
+			return fmt.Errorf("message has more than one OPT record")
+		}
+		if m.EDNS, err = ednsFromRecord(record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *Message) Pack() ([]byte, error) {
+	buffer := new(bytes.Buffer)
+	writer := NewMessageWriter(buffer)
+
+	header := DNSHeader{
+		ID:      m.ID,
+		Flags:   MarshalFlags(m.Flags),
+		QDCount: uint16(len(m.Question)),
+		ANCount: uint16(len(m.Answer)),
+		NSCount: uint16(len(m.Authority)),
+		ARCount: uint16(len(m.Additional)),
+	}
+
+	additional := m.Additional
+	if m.EDNS != nil {
+		header.ARCount++
+		additional = append(additional[:len(additional):len(additional)], m.EDNS.record())
+	}
+
+	if err := writer.WriteHeader(header); err != nil {
+		return nil, err
+	}
+
+	for _, question := range m.Question {
+		if err := writer.WriteQuestion(question); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, section := range [][]DNSAnswer{m.Answer, m.Authority, additional} {
+		for _, answer := range section {
+			if err := writer.WriteAnswer(answer); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func readSection(reader *bytes.Reader, count uint16) ([]DNSAnswer, error) {
+	var records []DNSAnswer
+	for i := 0; i < int(count); i++ {
+		record, err := ReadDNSAnswer(reader)
+		if err != nil {
+			return records, fmt.Errorf("failed to read record %d: %v", i, err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// SetReply prepares m as the response to query, echoing its ID and question.
+// Queries with EDNS get an OPT record so handlers can attach options; the
+// server settles its payload size and options before sending.
+func (m *Message) SetReply(query *Message, authoritative, recursionAvailable bool) {
+	m.ID = query.ID
+	m.Flags = ResponseFlags(query.Flags, authoritative, recursionAvailable)
+	m.Question = nil
+	if len(query.Question) > 0 {
+		m.Question = []DNSQuestion{query.Question[0]}
+	}
+	m.EDNS = nil
+	if query.EDNS != nil {
+		m.EDNS = &EDNS{UDPSize: DefaultUDPSize, Version: EDNSVersion, DO: query.EDNS.DO}
+	}
+}
@@ -0,0 +1,252 @@
+package dns
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+type Middleware func(next Handler) Handler
+
+// Chain wraps handler so that the first middleware is the outermost and sees
+// every query first and every response last.
+func Chain(handler Handler, middleware ...Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// responseRecorder keeps the message written through it so middleware can
+// inspect the response once the wrapped handler returns.
+type responseRecorder struct {
+	ResponseWriter
+	response *Message
+	rewrite  func(*Message)
+}
+
+func (r *responseRecorder) WriteMsg(m *Message) error {
+	if r.rewrite != nil {
+		r.rewrite(m)
+	}
+	if err := r.ResponseWriter.WriteMsg(m); err != nil {
+		return err
+	}
+	r.response = m
+	return nil
+}
+
+func WithLogging(logger *log.Logger) Middleware {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return func(next Handler) Handler {
+		return HandlerFunc(func(w ResponseWriter, r *Message) {
+			start := time.Now()
+			recorder := &responseRecorder{ResponseWriter: w}
+			next.ServeDNS(recorder, r)
+
+			question := "-"
+			if len(r.Question) > 0 {
+				q := r.Question[0]
+				question = fmt.Sprintf("%s %s %s", NameToString(q.QName), ClassToString(q.QClass), TypeToString(q.QType))
+			}
+
+			if recorder.response == nil {
+				logger.Printf("%s %d %s no response %s", w.RemoteAddr(), r.ID, question, time.Since(start))
+				return
+			}
+			logger.Printf("%s %d %s rcode=%d answers=%d %s", w.RemoteAddr(), r.ID, question,
+				recorder.response.RCode(), len(recorder.response.Answer), time.Since(start))
+		})
+	}
+}
+
+// WithRecovery turns a panicking handler into a SERVFAIL response instead of
+// taking down the server.
+func WithRecovery(logger *log.Logger) Middleware {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return func(next Handler) Handler {
+		return HandlerFunc(func(w ResponseWriter, r *Message) {
+			recorder := &responseRecorder{ResponseWriter: w}
+			defer func() {
+				recovered := recover()
+				if recovered == nil {
+					return
+				}
+				logger.Printf("panic serving %s: %v\n%s", w.RemoteAddr(), recovered, debug.Stack())
+				if recorder.response != nil {
+					return
+				}
+
+				var response Message
+				response.SetReply(r, false, false)
+				response.SetRCode(RCodeServFail)
+				response.SetExtendedError(EDEOther, "internal server error")
+				w.WriteMsg(&response)
+			}()
+			next.ServeDNS(recorder, r)
+		})
+	}
+}
+
+type Metrics struct {
+	mu           sync.Mutex
+	queries      uint64
+	unanswered   uint64
+	rcodes       map[uint16]uint64
+	qtypes       map[uint16]uint64
+	totalLatency time.Duration
+}
+
+type MetricsSnapshot struct {
+	Queries      uint64
+	Unanswered   uint64
+	RCodes       map[uint16]uint64
+	QTypes       map[uint16]uint64
+	TotalLatency time.Duration
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		rcodes: make(map[uint16]uint64),
+		qtypes: make(map[uint16]uint64),
+	}
+}
+
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := MetricsSnapshot{
+		Queries:      m.queries,
+		Unanswered:   m.unanswered,
+		RCodes:       make(map[uint16]uint64, len(m.rcodes)),
+		QTypes:       make(map[uint16]uint64, len(m.qtypes)),
+		TotalLatency: m.totalLatency,
+	}
+	for rcode, count := range m.rcodes {
+		snapshot.RCodes[rcode] = count
+	}
+	for qtype, count := range m.qtypes {
+		snapshot.QTypes[qtype] = count
+	}
+	return snapshot
+}
+
+func WithMetrics(metrics *Metrics) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(w ResponseWriter, r *Message) {
+			start := time.Now()
+			recorder := &responseRecorder{ResponseWriter: w}
+			next.ServeDNS(recorder, r)
+			elapsed := time.Since(start)
+
+			metrics.mu.Lock()
+			defer metrics.mu.Unlock()
+
+			metrics.queries++
+			metrics.totalLatency += elapsed
+			if len(r.Question) > 0 {
+				metrics.qtypes[r.Question[0].QType]++
+			}
+			if recorder.response == nil {
+				metrics.unanswered++
+				return
+			}
+			metrics.rcodes[recorder.response.RCode()]++
+		})
+	}
+}
+
+// ACL decides which clients may query. Deny entries win over Allow entries,
+// and an empty Allow list admits every address that is not denied.
+type ACL struct {
+	Allow []*net.IPNet
+	Deny  []*net.IPNet
+}
+
+func NewACL(allow, deny []string) (*ACL, error) {
+	acl := &ACL{}
+	var err error
+	if acl.Allow, err = ParseNetworks(allow); err != nil {
+		return nil, err
+	}
+	if acl.Deny, err = ParseNetworks(deny); err != nil {
+		return nil, err
+	}
+	return acl, nil
+}
+
+func (acl *ACL) Permits(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range acl.Deny {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	if len(acl.Allow) == 0 {
+		return true
+	}
+	for _, network := range acl.Allow {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func WithACL(acl *ACL) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(w ResponseWriter, r *Message) {
+			if !acl.Permits(addrIP(w.RemoteAddr())) {
+				refuse(w, r, EDEProhibited, "client is not allowed to query this server")
+				return
+			}
+			next.ServeDNS(w, r)
+		})
+	}
+}
+
+// WithRewrite lets rewrite change every response before it is written, with
+// the query available for context.
+func WithRewrite(rewrite func(r *Message, response *Message)) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(w ResponseWriter, r *Message) {
+			recorder := &responseRecorder{
+				ResponseWriter: w,
+				rewrite:        func(response *Message) { rewrite(r, response) },
+			}
+			next.ServeDNS(recorder, r)
+		})
+	}
+}
+
+// ParseNetworks parses CIDR networks and bare addresses, which stand for a
+// network holding just that address.
+func ParseNetworks(entries []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range entries {
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			networks = append(networks, network)
+			continue
+		}
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid address or network %q", entry)
+		}
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	return networks, nil
+}
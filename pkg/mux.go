@@ -0,0 +1,103 @@
+package dns
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ServeMux sends each query to the handler registered for the longest zone
+// that contains the query name. Zone matching ignores ASCII case.
+type ServeMux struct {
+	mu    sync.RWMutex
+	zones map[string]Handler
+}
+
+func NewServeMux() *ServeMux {
+	return &ServeMux{zones: make(map[string]Handler)}
+}
+
+var DefaultServeMux = NewServeMux()
+
+func (mux *ServeMux) Handle(zone string, handler Handler) {
+	name, err := ParseName(zone)
+	if err != nil {
+		panic(fmt.Sprintf("dns: invalid zone %q: %v", zone, err))
+	}
+	if handler == nil {
+		panic("dns: nil handler")
+	}
+
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	mux.zones[canonicalName(name)] = handler
+}
+
+func (mux *ServeMux) HandleFunc(zone string, handler func(ResponseWriter, *Message)) {
+	mux.Handle(zone, HandlerFunc(handler))
+}
+
+func (mux *ServeMux) HandleRemove(zone string) {
+	name, err := ParseName(zone)
+	if err != nil {
+		return
+	}
+
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	delete(mux.zones, canonicalName(name))
+}
+
+// Handler returns the handler for the longest registered zone containing
+// name, or nil if no zone matches.
+func (mux *ServeMux) Handler(name []byte) Handler {
+	key := canonicalName(name)
+
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
+
+	for i := 0; i < len(key); {
+		if handler, ok := mux.zones[key[i:]]; ok {
+			return handler
+		}
+		if key[i] == 0 {
+			break
+		}
+		i += int(key[i]) + 1
+	}
+	return nil
+}
+
+func (mux *ServeMux) ServeDNS(w ResponseWriter, r *Message) {
+	if len(r.Question) == 0 {
+		refuse(w, r, EDEOther, "query has no question")
+		return
+	}
+
+	handler := mux.Handler(r.Question[0].QName)
+	if handler == nil {
+		refuse(w, r, EDENotAuthoritative, "no zone configured for this name")
+		return
+	}
+	handler.ServeDNS(w, r)
+}
+
+func Handle(zone string, handler Handler) {
+	DefaultServeMux.Handle(zone, handler)
+}
+
+func HandleFunc(zone string, handler func(ResponseWriter, *Message)) {
+	DefaultServeMux.HandleFunc(zone, handler)
+}
+
+// canonicalName lowercases the ASCII letters of a wire format name. Length
+// octets are at most 63 so they are never mistaken for letters.
+func canonicalName(name []byte) string {
+	lower := make([]byte, len(name))
+	for i, c := range name {
+		if c >= 'A' && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		lower[i] = c
+	}
+	return string(lower)
+}
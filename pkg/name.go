@@ -0,0 +1,141 @@
+package dns
+
+import (
+	"fmt"
+	"strings"
+)
+
+func ParseName(name string) ([]byte, error) {
+	if name == "" {
+		return nil, fmt.Errorf("empty domain name")
+	}
+	if name == "." {
+		return []byte{0}, nil
+	}
+
+	var wire []byte
+	var label []byte
+	appendLabel := func() error {
+		if len(label) == 0 {
+			return fmt.Errorf("empty label in %q", name)
+		}
+		if len(label) > 63 {
+			return fmt.Errorf("label exceeds 63 octets in %q", name)
+		}
+		wire = append(wire, byte(len(label)))
+		wire = append(wire, label...)
+		label = label[:0]
+		return nil
+	}
+
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c == '.':
+			if err := appendLabel(); err != nil {
+				return nil, err
+			}
+		case c == '\\':
+			if i+3 < len(name) && isDigit(name[i+1]) && isDigit(name[i+2]) && isDigit(name[i+3]) {
+				value := int(name[i+1]-'0')*100 + int(name[i+2]-'0')*10 + int(name[i+3]-'0')
+				if value > 255 {
+					return nil, fmt.Errorf("invalid escape in %q", name)
+				}
+				label = append(label, byte(value))
+				i += 3
+			} else if i+1 < len(name) {
+				label = append(label, name[i+1])
+				i++
+			} else {
+				return nil, fmt.Errorf("trailing backslash in %q", name)
+			}
+		default:
+			label = append(label, c)
+		}
+	}
+
+	// Names are always treated as fully qualified, with or without the final dot
+	if len(label) > 0 {
+		if err := appendLabel(); err != nil {
+			return nil, err
+		}
+	}
+	wire = append(wire, 0)
+
+	if len(wire) > MaxDomainNameLength {
+		return nil, fmt.Errorf("domain name exceeds %d octets", MaxDomainNameLength)
+	}
+
+	return wire, nil
+}
+
+// parseRelativeName resolves names that do not end in a dot, and "@", against
+// origin. With a nil origin every name is taken as fully qualified.
+func parseRelativeName(name string, origin []byte) ([]byte, error) {
+	if origin == nil {
+		return ParseName(name)
+	}
+	if name == "@" {
+		return origin, nil
+	}
+	if isFullyQualified(name) {
+		return ParseName(name)
+	}
+
+	relative, err := ParseName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	combined := append(relative[:len(relative)-1:len(relative)-1], origin...)
+	if len(combined) > MaxDomainNameLength {
+		return nil, fmt.Errorf("domain name exceeds %d octets", MaxDomainNameLength)
+	}
+	return combined, nil
+}
+
+func isFullyQualified(name string) bool {
+	if !strings.HasSuffix(name, ".") {
+		return false
+	}
+	// An odd number of backslashes means the final dot is escaped
+	backslashes := 0
+	for i := len(name) - 2; i >= 0 && name[i] == '\\'; i-- {
+		backslashes++
+	}
+	return backslashes%2 == 0
+}
+
+func NameToString(name []byte) string {
+	if len(name) == 0 || name[0] == 0 {
+		return "."
+	}
+
+	var builder strings.Builder
+	for i := 0; i < len(name) && name[i] != 0; {
+		length := int(name[i])
+		end := i + 1 + length
+		if end > len(name) {
+			end = len(name)
+		}
+		for _, c := range name[i+1 : end] {
+			switch {
+			case c == '.' || c == '\\' || c == '"' || c == ';' || c == '(' || c == ')' || c == '@' || c == '$':
+				builder.WriteByte('\\')
+				builder.WriteByte(c)
+			case c < 0x21 || c > 0x7E:
+				fmt.Fprintf(&builder, "\\%03d", c)
+			default:
+				builder.WriteByte(c)
+			}
+		}
+		builder.WriteByte('.')
+		i = end
+	}
+
+	return builder.String()
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,78 @@
+//go:build linux
+
+package dns
+
+import (
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+// enablePacketInfo asks the kernel to report the destination address of
+// every datagram, so replies on a wildcard socket can leave from the address
+// the query was sent to. IPv6 sockets also receive IPv4 packet info for
+// IPv4-mapped traffic.
+func enablePacketInfo(conn *net.UDPConn) bool {
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return false
+	}
+
+	enabled := false
+	rawConn.Control(func(fd uintptr) {
+		if syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_PKTINFO, 1) == nil {
+			enabled = true
+		}
+		if syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_RECVPKTINFO, 1) == nil {
+			enabled = true
+		}
+	})
+	return enabled
+}
+
+// parsePacketInfo returns the destination address found in the control
+// messages of a received datagram, or nil.
+func parsePacketInfo(oob []byte) net.IP {
+	messages, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil
+	}
+
+	for _, message := range messages {
+		switch {
+		case message.Header.Level == syscall.IPPROTO_IP && message.Header.Type == syscall.IP_PKTINFO &&
+			len(message.Data) >= syscall.SizeofInet4Pktinfo:
+			info := (*syscall.Inet4Pktinfo)(unsafe.Pointer(&message.Data[0]))
+			return net.IP(append([]byte(nil), info.Addr[:]...))
+		case message.Header.Level == syscall.IPPROTO_IPV6 && message.Header.Type == syscall.IPV6_PKTINFO &&
+			len(message.Data) >= syscall.SizeofInet6Pktinfo:
+			info := (*syscall.Inet6Pktinfo)(unsafe.Pointer(&message.Data[0]))
+			return net.IP(append([]byte(nil), info.Addr[:]...))
+		}
+	}
+	return nil
+}
+
+// packetInfoControl builds the control message that sends a reply from
+// source.
+func packetInfoControl(source net.IP) []byte {
+	if ip4 := source.To4(); ip4 != nil {
+		oob := make([]byte, syscall.CmsgSpace(syscall.SizeofInet4Pktinfo))
+		header := (*syscall.Cmsghdr)(unsafe.Pointer(&oob[0]))
+		header.Level = syscall.IPPROTO_IP
+		header.Type = syscall.IP_PKTINFO
+		header.SetLen(syscall.CmsgLen(syscall.SizeofInet4Pktinfo))
+		info := (*syscall.Inet4Pktinfo)(unsafe.Pointer(&oob[syscall.CmsgLen(0)]))
+		copy(info.Spec_dst[:], ip4)
+		return oob
+	}
+
+	oob := make([]byte, syscall.CmsgSpace(syscall.SizeofInet6Pktinfo))
+	header := (*syscall.Cmsghdr)(unsafe.Pointer(&oob[0]))
+	header.Level = syscall.IPPROTO_IPV6
+	header.Type = syscall.IPV6_PKTINFO
+	header.SetLen(syscall.CmsgLen(syscall.SizeofInet6Pktinfo))
+	info := (*syscall.Inet6Pktinfo)(unsafe.Pointer(&oob[syscall.CmsgLen(0)]))
+	copy(info.Addr[:], source.To16())
+	return oob
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package dns
+
+import "net"
+
+// Elsewhere replies leave from whatever address the kernel picks, which is
+// only a problem for wildcard binds on multi-homed hosts.
+func enablePacketInfo(conn *net.UDPConn) bool { return false }
+
+func parsePacketInfo(oob []byte) net.IP { return nil }
+
+func packetInfoControl(source net.IP) []byte { return nil }
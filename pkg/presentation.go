@@ -0,0 +1,344 @@
+package dns
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+type UnknownRecord struct {
+	RRType uint16
+	Data   []byte
+}
+
+func (r *UnknownRecord) Type() uint16 { return r.RRType }
+
+func (r *UnknownRecord) String() string {
+	if len(r.Data) == 0 {
+		return "\\# 0"
+	}
+	return fmt.Sprintf("\\# %d %s", len(r.Data), strings.ToUpper(hex.EncodeToString(r.Data)))
+}
+
+func (r *UnknownRecord) pack(w *MessageWriter) error {
+	_, err := w.buffer.Write(r.Data)
+	return err
+}
+
+func (r *UnknownRecord) unpack(reader *bytes.Reader, length int) error {
+	r.Data = make([]byte, length)
+	_, err := io.ReadFull(reader, r.Data)
+	return err
+}
+
+func TypeToString(rrtype uint16) string {
+	if name, ok := typeNames[rrtype]; ok {
+		return name
+	}
+	return fmt.Sprintf("TYPE%d", rrtype)
+}
+
+func StringToType(name string) (uint16, error) {
+	upper := strings.ToUpper(name)
+	for rrtype, mnemonic := range typeNames {
+		if mnemonic == upper {
+			return rrtype, nil
+		}
+	}
+	if strings.HasPrefix(upper, "TYPE") {
+		if value, err := strconv.ParseUint(upper[4:], 10, 16); err == nil {
+			return uint16(value), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown record type %q", name)
+}
+
+func ClassToString(class uint16) string {
+	if name, ok := classNames[class]; ok {
+		return name
+	}
+	return fmt.Sprintf("CLASS%d", class)
+}
+
+func StringToClass(name string) (uint16, error) {
+	upper := strings.ToUpper(name)
+	for class, mnemonic := range classNames {
+		if mnemonic == upper {
+			return class, nil
+		}
+	}
+	if strings.HasPrefix(upper, "CLASS") {
+		if value, err := strconv.ParseUint(upper[5:], 10, 16); err == nil {
+			return uint16(value), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown class %q", name)
+}
+
+func (a DNSAnswer) String() string {
+	data := a.Data
+	if data == nil {
+		data = &UnknownRecord{RRType: a.Type, Data: a.RData}
+	}
+	return fmt.Sprintf("%s\t%d\t%s\t%s\t%s", NameToString(a.Name), a.TTL,
+		ClassToString(a.Class), TypeToString(a.Type), data.String())
+}
+
+// ParseRR parses a single resource record in presentation format, for
+// example "www.example.com. 300 IN A 192.0.2.1". The TTL and class may be
+// left out and default to 0 and IN.
+func ParseRR(record string) (DNSAnswer, error) {
+	fields, err := splitFields(record)
+	if err != nil {
+		return DNSAnswer{}, err
+	}
+	if len(fields) < 2 {
+		return DNSAnswer{}, fmt.Errorf("incomplete record %q", record)
+	}
+
+	answer := DNSAnswer{Class: ClassIN}
+	if answer.Name, err = ParseName(fields[0]); err != nil {
+		return answer, err
+	}
+	fields = fields[1:]
+
+	for len(fields) > 0 {
+		if ttl, err := strconv.ParseUint(fields[0], 10, 32); err == nil {
+			answer.TTL = uint32(ttl)
+		} else if class, err := StringToClass(fields[0]); err == nil {
+			answer.Class = class
+		} else {
+			break
+		}
+		fields = fields[1:]
+	}
+
+	if len(fields) == 0 {
+		return answer, fmt.Errorf("missing record type in %q", record)
+	}
+	if answer.Type, err = StringToType(fields[0]); err != nil {
+		return answer, err
+	}
+
+	answer.Data, err = ParseRData(answer.Type, fields[1:])
+	return answer, err
+}
+
+func ParseRData(rrtype uint16, fields []string) (RData, error) {
+	return parseRData(rrtype, fields, nil)
+}
+
+func parseRData(rrtype uint16, fields []string, origin []byte) (RData, error) {
+	if len(fields) > 0 && fields[0] == "\\#" {
+		return parseGenericRData(rrtype, fields[1:])
+	}
+
+	if _, ok := rdataTypes[rrtype]; !ok {
+		return nil, fmt.Errorf("%s RDATA must use the \\# syntax", TypeToString(rrtype))
+	}
+
+	name := func(i int) ([]byte, error) {
+		return parseRelativeName(fields[i], origin)
+	}
+	number := func(i int, bits int) (uint64, error) {
+		value, err := strconv.ParseUint(fields[i], 10, bits)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number %q", fields[i])
+		}
+		return value, nil
+	}
+
+	want := map[uint16]int{
+		TypeA: 1, TypeAAAA: 1, TypeNS: 1, TypeCNAME: 1, TypePTR: 1,
+		TypeMX: 2, TypeSOA: 7, TypeSRV: 4,
+	}
+	if count, ok := want[rrtype]; ok && len(fields) != count {
+		return nil, fmt.Errorf("%s RDATA needs %d fields, got %d", TypeToString(rrtype), count, len(fields))
+	}
+
+	switch rrtype {
+	case TypeA:
+		ip := net.ParseIP(fields[0]).To4()
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IPv4 address %q", fields[0])
+		}
+		return &ARecord{IP: ip}, nil
+	case TypeAAAA:
+		ip := net.ParseIP(fields[0])
+		if ip == nil || ip.To4() != nil {
+			return nil, fmt.Errorf("invalid IPv6 address %q", fields[0])
+		}
+		return &AAAARecord{IP: ip}, nil
+	case TypeNS:
+		host, err := name(0)
+		return &NSRecord{Host: host}, err
+	case TypeCNAME:
+		target, err := name(0)
+		return &CNAMERecord{Target: target}, err
+	case TypePTR:
+		target, err := name(0)
+		return &PTRRecord{Target: target}, err
+	case TypeMX:
+		preference, err := number(0, 16)
+		if err != nil {
+			return nil, err
+		}
+		exchange, err := name(1)
+		return &MXRecord{Preference: uint16(preference), Exchange: exchange}, err
+	case TypeTXT:
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("TXT RDATA needs at least one string")
+		}
+		record := &TXTRecord{}
+		for _, field := range fields {
+			text, err := unquoteString(field)
+			if err != nil {
+				return nil, err
+			}
+			record.Text = append(record.Text, text)
+		}
+		return record, nil
+	case TypeSOA:
+		var err error
+		record := &SOARecord{}
+		if record.MName, err = name(0); err != nil {
+			return nil, err
+		}
+		if record.RName, err = name(1); err != nil {
+			return nil, err
+		}
+		for i, field := range []*uint32{&record.Serial, &record.Refresh, &record.Retry, &record.Expire, &record.Minimum} {
+			value, err := number(i+2, 32)
+			if err != nil {
+				return nil, err
+			}
+			*field = uint32(value)
+		}
+		return record, nil
+	case TypeSRV:
+		record := &SRVRecord{}
+		for i, field := range []*uint16{&record.Priority, &record.Weight, &record.Port} {
+			value, err := number(i, 16)
+			if err != nil {
+				return nil, err
+			}
+			*field = uint16(value)
+		}
+		var err error
+		record.Target, err = name(3)
+		return record, err
+	}
+
+	return nil, fmt.Errorf("no presentation parser for %s", TypeToString(rrtype))
+}
+
+// parseGenericRData reads the RFC 3597 form "\# <length> <hex>...". Known
+// types are decoded into their typed RDATA.
+func parseGenericRData(rrtype uint16, fields []string) (RData, error) {
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("missing RDATA length after \\#")
+	}
+
+	length, err := strconv.ParseUint(fields[0], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RDATA length %q", fields[0])
+	}
+
+	data, err := hex.DecodeString(strings.Join(fields[1:], ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid RDATA hex: %v", err)
+	}
+	if len(data) != int(length) {
+		return nil, fmt.Errorf("RDATA length is %d but %d octets were given", length, len(data))
+	}
+
+	newData, ok := rdataTypes[rrtype]
+	if !ok {
+		return &UnknownRecord{RRType: rrtype, Data: data}, nil
+	}
+
+	typed := newData()
+	reader := bytes.NewReader(data)
+	if err := typed.unpack(reader, len(data)); err != nil {
+		return nil, fmt.Errorf("invalid %s RDATA: %v", TypeToString(rrtype), err)
+	}
+	if reader.Len() != 0 {
+		return nil, fmt.Errorf("trailing octets in %s RDATA", TypeToString(rrtype))
+	}
+	return typed, nil
+}
+
+// splitFields breaks a line on whitespace while keeping quoted strings,
+// including their quotes, together.
+func splitFields(line string) ([]string, error) {
+	var fields []string
+	var field strings.Builder
+	inField, quoted := false, false
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\' && i+1 < len(line):
+			field.WriteByte(c)
+			field.WriteByte(line[i+1])
+			inField = true
+			i++
+		case c == '"':
+			field.WriteByte(c)
+			inField = true
+			quoted = !quoted
+		case (c == ' ' || c == '\t') && !quoted:
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		default:
+			field.WriteByte(c)
+			inField = true
+		}
+	}
+
+	if quoted {
+		return nil, fmt.Errorf("unterminated quoted string")
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+	return fields, nil
+}
+
+func unquoteString(field string) (string, error) {
+	if len(field) >= 2 && field[0] == '"' && field[len(field)-1] == '"' {
+		field = field[1 : len(field)-1]
+	}
+
+	var builder strings.Builder
+	for i := 0; i < len(field); i++ {
+		c := field[i]
+		if c != '\\' {
+			builder.WriteByte(c)
+			continue
+		}
+		if i+3 < len(field) && isDigit(field[i+1]) && isDigit(field[i+2]) && isDigit(field[i+3]) {
+			value, _ := strconv.Atoi(field[i+1 : i+4])
+			if value > 255 {
+				return "", fmt.Errorf("invalid escape in %q", field)
+			}
+			builder.WriteByte(byte(value))
+			i += 3
+		} else if i+1 < len(field) {
+			builder.WriteByte(field[i+1])
+			i++
+		}
+	}
+
+	if builder.Len() > 255 {
+		return "", fmt.Errorf("character string exceeds 255 octets")
+	}
+	return builder.String(), nil
+}
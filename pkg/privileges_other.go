@@ -0,0 +1,9 @@
+//go:build !unix
+
+package dns
+
+import "errors"
+
+func DropPrivileges(username, groupname string) error {
+	return errors.New("dropping privileges is not supported on this platform")
+}
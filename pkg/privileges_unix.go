@@ -0,0 +1,50 @@
+//go:build unix
+
+package dns
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// DropPrivileges switches the process to the named user and group, which is
+// meant to happen right after binding privileged ports. An empty group uses
+// the user's primary group. The supplementary groups are first replaced by
+// that group alone, since root's could otherwise keep their access.
+func DropPrivileges(username, groupname string) error {
+	account, err := user.Lookup(username)
+	if err != nil {
+		return fmt.Errorf("failed to look up user %q: %v", username, err)
+	}
+	uid, err := strconv.Atoi(account.Uid)
+	if err != nil {
+		return fmt.Errorf("user %q has a non-numeric uid %q", username, account.Uid)
+	}
+
+	gidString := account.Gid
+	if groupname != "" {
+		group, err := user.LookupGroup(groupname)
+		if err != nil {
+			return fmt.Errorf("failed to look up group %q: %v", groupname, err)
+		}
+		gidString = group.Gid
+	}
+	gid, err := strconv.Atoi(gidString)
+	if err != nil {
+		return fmt.Errorf("group has a non-numeric gid %q", gidString)
+	}
+
+	// The group has to change while we are still allowed to change it
+	if err := syscall.Setgroups([]int{gid}); err != nil {
+		return fmt.Errorf("failed to set supplementary groups: %v", err)
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return fmt.Errorf("failed to set group id %d: %v", gid, err)
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return fmt.Errorf("failed to set user id %d: %v", uid, err)
+	}
+	return nil
+}
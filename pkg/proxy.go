@@ -0,0 +1,219 @@
+package dns
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// proxySignature starts every PROXY protocol version 2 header.
+var proxySignature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+const (
+	proxyHeaderLength = 16
+
+	proxyVersion2   = 0x20
+	proxyCmdLocal   = 0x00
+	proxyCmdProxy   = 0x01
+	proxyFamilyIPv4 = 0x10
+	proxyFamilyIPv6 = 0x20
+)
+
+var errNotProxied = errors.New("no PROXY protocol header")
+
+// proxyHeader is what a PROXY protocol v2 header says about the client.
+// source and destination are nil for LOCAL connections, such as health
+// checks from the balancer itself, and for address families we ignore.
+type proxyHeader struct {
+	source      net.IP
+	sourcePort  int
+	destination net.IP
+	destPort    int
+}
+
+// readProxyHeader reads a PROXY protocol v2 header. It returns errNotProxied
+// without consuming anything when reader does not start with the signature.
+func readProxyHeader(reader *bufio.Reader) (proxyHeader, error) {
+	prefix, err := reader.Peek(len(proxySignature))
+	if err != nil || !bytes.Equal(prefix, proxySignature) {
+		return proxyHeader{}, errNotProxied
+	}
+
+	var fixed [proxyHeaderLength]byte
+	if _, err := io.ReadFull(reader, fixed[:]); err != nil {
+		return proxyHeader{}, err
+	}
+	body := make([]byte, binary.BigEndian.Uint16(fixed[14:]))
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return proxyHeader{}, err
+	}
+	return parseProxyHeader(fixed[12], fixed[13], body)
+}
+
+// splitProxyHeader separates a PROXY protocol v2 header from the datagram
+// that follows it.
+func splitProxyHeader(packet []byte) (proxyHeader, []byte, error) {
+	if !bytes.HasPrefix(packet, proxySignature) {
+		return proxyHeader{}, packet, errNotProxied
+	}
+	if len(packet) < proxyHeaderLength {
+		return proxyHeader{}, nil, fmt.Errorf("truncated PROXY protocol header")
+	}
+	end := proxyHeaderLength + int(binary.BigEndian.Uint16(packet[14:]))
+	if len(packet) < end {
+		return proxyHeader{}, nil, fmt.Errorf("truncated PROXY protocol header")
+	}
+	header, err := parseProxyHeader(packet[12], packet[13], packet[proxyHeaderLength:end])
+	return header, packet[end:], err
+}
+
+func parseProxyHeader(versionCommand, family byte, body []byte) (proxyHeader, error) {
+	if versionCommand&0xF0 != proxyVersion2 {
+		return proxyHeader{}, fmt.Errorf("unsupported PROXY protocol version %d", versionCommand>>4)
+	}
+
+	switch versionCommand & 0x0F {
+	case proxyCmdLocal:
+		return proxyHeader{}, nil
+	case proxyCmdProxy:
+	default:
+		return proxyHeader{}, fmt.Errorf("unsupported PROXY protocol command %d", versionCommand&0x0F)
+	}
+
+	// The low nibble is the transport, which the listener already knows.
+	// Any TLVs after the addresses are skipped.
+	var size int
+	switch family & 0xF0 {
+	case proxyFamilyIPv4:
+		size = net.IPv4len
+	case proxyFamilyIPv6:
+		size = net.IPv6len
+	default:
+		return proxyHeader{}, nil
+	}
+	if len(body) < 2*size+4 {
+		return proxyHeader{}, fmt.Errorf("PROXY protocol addresses are truncated")
+	}
+
+	return proxyHeader{
+		source:      net.IP(append([]byte(nil), body[:size]...)),
+		destination: net.IP(append([]byte(nil), body[size:2*size]...)),
+		sourcePort:  int(binary.BigEndian.Uint16(body[2*size:])),
+		destPort:    int(binary.BigEndian.Uint16(body[2*size+2:])),
+	}, nil
+}
+
+// trustsProxy reports whether addr may prefix its traffic with a PROXY
+// protocol header. Everyone else is taken at face value, since honouring
+// headers from arbitrary clients would let them pick their own address.
+func (s *Server) trustsProxy(addr net.Addr) bool {
+	ip := addrIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range s.ProxyTrusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyPacket replaces the addresses of a datagram from a trusted balancer
+// with the ones its PROXY protocol header carries. ok is false when the
+// header is malformed and the datagram should be dropped.
+func (s *Server) proxyPacket(local, source net.Addr, packet []byte) (net.Addr, net.Addr, []byte, bool) {
+	if !s.trustsProxy(source) {
+		return local, source, packet, true
+	}
+
+	header, packet, err := splitProxyHeader(packet)
+	switch {
+	case errors.Is(err, errNotProxied):
+		return local, source, packet, true
+	case err != nil:
+		s.malformed.Add(1)
+		return nil, nil, nil, false
+	case header.source == nil:
+		return local, source, packet, true
+	}
+
+	return &net.UDPAddr{IP: header.destination, Port: header.destPort},
+		&net.UDPAddr{IP: header.source, Port: header.sourcePort}, packet, true
+}
+
+// proxyListener hands out connections that report the client address from
+// a PROXY protocol header, when the peer is trusted to send one.
+type proxyListener struct {
+	net.Listener
+	server *Server
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil || !l.server.trustsProxy(conn.RemoteAddr()) {
+		return conn, err
+	}
+	return &proxyConn{Conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+// proxyConn reads the header lazily, on the first Read or address lookup, so
+// a slow balancer cannot hold up Accept and the read deadline applies.
+type proxyConn struct {
+	net.Conn
+	reader *bufio.Reader
+
+	once   sync.Once
+	err    error
+	local  net.Addr
+	remote net.Addr
+}
+
+func (c *proxyConn) readHeader() {
+	c.once.Do(func() {
+		c.local, c.remote = c.Conn.LocalAddr(), c.Conn.RemoteAddr()
+
+		header, err := readProxyHeader(c.reader)
+		if errors.Is(err, errNotProxied) {
+			return
+		}
+		if err != nil {
+			c.err = fmt.Errorf("malformed PROXY protocol header: %v", err)
+			return
+		}
+		if header.source != nil {
+			c.local = &net.TCPAddr{IP: header.destination, Port: header.destPort}
+			c.remote = &net.TCPAddr{IP: header.source, Port: header.sourcePort}
+		}
+	})
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.readHeader()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+func (c *proxyConn) LocalAddr() net.Addr {
+	c.readHeader()
+	return c.local
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.readHeader()
+	return c.remote
+}
+
+func (s *Server) proxyListener(listener net.Listener) net.Listener {
+	if len(s.ProxyTrusted) == 0 {
+		return listener
+	}
+	return &proxyListener{Listener: listener, server: s}
+}
@@ -4,6 +4,12 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
+)
+
+const (
+	MaxDomainNameLength    = 255
+	MaxCompressionPointers = 126
 )
 
 type DNSQuestion struct {
@@ -35,15 +41,19 @@ func ReadDNSQuestion(reader *bytes.Reader) (DNSQuestion, error) {
 }
 
 func WriteDNSQuestion(buffer *bytes.Buffer, question DNSQuestion) error {
-	if _, err := buffer.Write(question.QName); err != nil {
+	return NewMessageWriter(buffer).WriteQuestion(question)
+}
+
+func (w *MessageWriter) WriteQuestion(question DNSQuestion) error {
+	if err := w.WriteName(question.QName); err != nil {
 		return fmt.Errorf("failed to write QName: %v", err)
 	}
 
-	if err := binary.Write(buffer, binary.BigEndian, question.QType); err != nil {
+	if err := binary.Write(w.buffer, binary.BigEndian, question.QType); err != nil {
 		return fmt.Errorf("failed to write QType: %v", err)
 	}
 
-	if err := binary.Write(buffer, binary.BigEndian, question.QClass); err != nil {
+	if err := binary.Write(w.buffer, binary.BigEndian, question.QClass); err != nil {
 		return fmt.Errorf("failed to write QClass: %v", err)
 	}
 
@@ -52,6 +62,10 @@ func WriteDNSQuestion(buffer *bytes.Buffer, question DNSQuestion) error {
 
 func readDomainName(reader *bytes.Reader) ([]byte, error) {
 	var name []byte
+	var returnOffset int64 = -1
+	visited := make(map[int64]bool)
+	hops := 0
+
 	for {
 		length, err := reader.ReadByte()
 		if err != nil {
@@ -62,12 +76,47 @@ func readDomainName(reader *bytes.Reader) ([]byte, error) {
 			break
 		}
 
-		if length&0xC0 == 0xC0 {
+		switch length & 0xC0 {
+		case 0xC0:
+			next, err := reader.ReadByte()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read compression pointer: %v", err)
+			}
+
+			hops++
+			if hops > MaxCompressionPointers {
+				return nil, fmt.Errorf("too many compression pointers")
+			}
+
+			// Only the first pointer decides where parsing resumes once the name is complete
+			if returnOffset < 0 {
+				returnOffset, _ = reader.Seek(0, io.SeekCurrent)
+			}
+
+			offset := int64(length&0x3F)<<8 | int64(next)
+			if visited[offset] {
+				return nil, fmt.Errorf("compression pointer loop at offset %d", offset)
+			}
+			visited[offset] = true
+
+			if offset >= reader.Size() {
+				return nil, fmt.Errorf("compression pointer %d out of range", offset)
+			}
+
+			if _, err := reader.Seek(offset, io.SeekStart); err != nil {
+				return nil, fmt.Errorf("failed to follow compression pointer: %v", err)
+			}
+			continue
+		case 0x40, 0x80:
+			return nil, fmt.Errorf("unsupported label type 0x%02x", length&0xC0)
+		}
 
+		if len(name)+int(length)+2 > MaxDomainNameLength {
+			return nil, fmt.Errorf("domain name exceeds %d octets", MaxDomainNameLength)
 		}
 
 		label := make([]byte, length)
-		if _, err := reader.Read(label); err != nil {
+		if _, err := io.ReadFull(reader, label); err != nil {
 			return nil, fmt.Errorf("failed to read label: %v", err)
 		}
 
@@ -75,5 +124,12 @@ func readDomainName(reader *bytes.Reader) ([]byte, error) {
 		name = append(name, label...)
 	}
 	name = append(name, 0)
+
+	if returnOffset >= 0 {
+		if _, err := reader.Seek(returnOffset, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("failed to restore reader position: %v", err)
+		}
+	}
+
 	return name, nil
 }
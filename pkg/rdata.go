@@ -0,0 +1,294 @@
+package dns
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+type RData interface {
+	Type() uint16
+	String() string
+	pack(w *MessageWriter) error
+	unpack(reader *bytes.Reader, length int) error
+}
+
+var rdataTypes = map[uint16]func() RData{
+	TypeA:     func() RData { return new(ARecord) },
+	TypeNS:    func() RData { return new(NSRecord) },
+	TypeCNAME: func() RData { return new(CNAMERecord) },
+	TypeSOA:   func() RData { return new(SOARecord) },
+	TypePTR:   func() RData { return new(PTRRecord) },
+	TypeMX:    func() RData { return new(MXRecord) },
+	TypeTXT:   func() RData { return new(TXTRecord) },
+	TypeAAAA:  func() RData { return new(AAAARecord) },
+	TypeSRV:   func() RData { return new(SRVRecord) },
+	TypeOPT:   func() RData { return new(OPTRecord) },
+}
+
+type ARecord struct {
+	IP net.IP
+}
+
+func (r *ARecord) Type() uint16 { return TypeA }
+
+func (r *ARecord) String() string { return r.IP.String() }
+
+func (r *ARecord) pack(w *MessageWriter) error {
+	ip := r.IP.To4()
+	if ip == nil {
+		return fmt.Errorf("invalid IPv4 address %v", r.IP)
+	}
+	_, err := w.buffer.Write(ip)
+	return err
+}
+
+func (r *ARecord) unpack(reader *bytes.Reader, length int) error {
+	if length != net.IPv4len {
+		return fmt.Errorf("invalid A record length %d", length)
+	}
+	r.IP = make(net.IP, net.IPv4len)
+	_, err := io.ReadFull(reader, r.IP)
+	return err
+}
+
+type AAAARecord struct {
+	IP net.IP
+}
+
+func (r *AAAARecord) Type() uint16 { return TypeAAAA }
+
+func (r *AAAARecord) String() string { return r.IP.String() }
+
+func (r *AAAARecord) pack(w *MessageWriter) error {
+	ip := r.IP.To16()
+	if ip == nil {
+		return fmt.Errorf("invalid IPv6 address %v", r.IP)
+	}
+	_, err := w.buffer.Write(ip)
+	return err
+}
+
+func (r *AAAARecord) unpack(reader *bytes.Reader, length int) error {
+	if length != net.IPv6len {
+		return fmt.Errorf("invalid AAAA record length %d", length)
+	}
+	r.IP = make(net.IP, net.IPv6len)
+	_, err := io.ReadFull(reader, r.IP)
+	return err
+}
+
+type NSRecord struct {
+	Host []byte
+}
+
+func (r *NSRecord) Type() uint16 { return TypeNS }
+
+func (r *NSRecord) String() string { return NameToString(r.Host) }
+
+func (r *NSRecord) pack(w *MessageWriter) error { return w.WriteName(r.Host) }
+
+func (r *NSRecord) unpack(reader *bytes.Reader, length int) (err error) {
+	r.Host, err = readDomainName(reader)
+	return err
+}
+
+type CNAMERecord struct {
+	Target []byte
+}
+
+func (r *CNAMERecord) Type() uint16 { return TypeCNAME }
+
+func (r *CNAMERecord) String() string { return NameToString(r.Target) }
+
+func (r *CNAMERecord) pack(w *MessageWriter) error { return w.WriteName(r.Target) }
+
+func (r *CNAMERecord) unpack(reader *bytes.Reader, length int) (err error) {
+	r.Target, err = readDomainName(reader)
+	return err
+}
+
+type PTRRecord struct {
+	Target []byte
+}
+
+func (r *PTRRecord) Type() uint16 { return TypePTR }
+
+func (r *PTRRecord) String() string { return NameToString(r.Target) }
+
+func (r *PTRRecord) pack(w *MessageWriter) error { return w.WriteName(r.Target) }
+
+func (r *PTRRecord) unpack(reader *bytes.Reader, length int) (err error) {
+	r.Target, err = readDomainName(reader)
+	return err
+}
+
+type MXRecord struct {
+	Preference uint16
+	Exchange   []byte
+}
+
+func (r *MXRecord) Type() uint16 { return TypeMX }
+
+func (r *MXRecord) String() string {
+	return fmt.Sprintf("%d %s", r.Preference, NameToString(r.Exchange))
+}
+
+func (r *MXRecord) pack(w *MessageWriter) error {
+	if err := binary.Write(w.buffer, binary.BigEndian, r.Preference); err != nil {
+		return err
+	}
+	return w.WriteName(r.Exchange)
+}
+
+func (r *MXRecord) unpack(reader *bytes.Reader, length int) (err error) {
+	if err := binary.Read(reader, binary.BigEndian, &r.Preference); err != nil {
+		return err
+	}
+	r.Exchange, err = readDomainName(reader)
+	return err
+}
+
+type TXTRecord struct {
+	Text []string
+}
+
+func (r *TXTRecord) Type() uint16 { return TypeTXT }
+
+func (r *TXTRecord) String() string {
+	quoted := make([]string, len(r.Text))
+	for i, text := range r.Text {
+		quoted[i] = quoteString(text)
+	}
+	return strings.Join(quoted, " ")
+}
+
+func (r *TXTRecord) pack(w *MessageWriter) error {
+	if len(r.Text) == 0 {
+		// A TXT record holds at least one, possibly empty, string
+		return w.buffer.WriteByte(0)
+	}
+	for _, text := range r.Text {
+		if len(text) > 255 {
+			return fmt.Errorf("TXT string exceeds 255 octets")
+		}
+		w.buffer.WriteByte(byte(len(text)))
+		w.buffer.WriteString(text)
+	}
+	return nil
+}
+
+func (r *TXTRecord) unpack(reader *bytes.Reader, length int) error {
+	r.Text = nil
+	for length > 0 {
+		size, err := reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		if int(size)+1 > length {
+			return fmt.Errorf("TXT string overruns RDATA")
+		}
+		text := make([]byte, size)
+		if _, err := io.ReadFull(reader, text); err != nil {
+			return err
+		}
+		r.Text = append(r.Text, string(text))
+		length -= int(size) + 1
+	}
+	return nil
+}
+
+type SOARecord struct {
+	MName   []byte
+	RName   []byte
+	Serial  uint32
+	Refresh uint32
+	Retry   uint32
+	Expire  uint32
+	Minimum uint32
+}
+
+func (r *SOARecord) Type() uint16 { return TypeSOA }
+
+func (r *SOARecord) String() string {
+	return fmt.Sprintf("%s %s %d %d %d %d %d", NameToString(r.MName), NameToString(r.RName),
+		r.Serial, r.Refresh, r.Retry, r.Expire, r.Minimum)
+}
+
+func (r *SOARecord) pack(w *MessageWriter) error {
+	if err := w.WriteName(r.MName); err != nil {
+		return err
+	}
+	if err := w.WriteName(r.RName); err != nil {
+		return err
+	}
+	return binary.Write(w.buffer, binary.BigEndian, []uint32{r.Serial, r.Refresh, r.Retry, r.Expire, r.Minimum})
+}
+
+func (r *SOARecord) unpack(reader *bytes.Reader, length int) (err error) {
+	if r.MName, err = readDomainName(reader); err != nil {
+		return err
+	}
+	if r.RName, err = readDomainName(reader); err != nil {
+		return err
+	}
+	for _, field := range []*uint32{&r.Serial, &r.Refresh, &r.Retry, &r.Expire, &r.Minimum} {
+		if err := binary.Read(reader, binary.BigEndian, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type SRVRecord struct {
+	Priority uint16
+	Weight   uint16
+	Port     uint16
+	Target   []byte
+}
+
+func (r *SRVRecord) Type() uint16 { return TypeSRV }
+
+func (r *SRVRecord) String() string {
+	return fmt.Sprintf("%d %d %d %s", r.Priority, r.Weight, r.Port, NameToString(r.Target))
+}
+
+func (r *SRVRecord) pack(w *MessageWriter) error {
+	if err := binary.Write(w.buffer, binary.BigEndian, []uint16{r.Priority, r.Weight, r.Port}); err != nil {
+		return err
+	}
+	// RFC 2782 forbids compressing the SRV target
+	return w.WriteUncompressedName(r.Target)
+}
+
+func (r *SRVRecord) unpack(reader *bytes.Reader, length int) (err error) {
+	for _, field := range []*uint16{&r.Priority, &r.Weight, &r.Port} {
+		if err := binary.Read(reader, binary.BigEndian, field); err != nil {
+			return err
+		}
+	}
+	r.Target, err = readDomainName(reader)
+	return err
+}
+
+func quoteString(text string) string {
+	var builder strings.Builder
+	builder.WriteByte('"')
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '"' || c == '\\':
+			builder.WriteByte('\\')
+			builder.WriteByte(c)
+		case c < 0x20 || c > 0x7E:
+			fmt.Fprintf(&builder, "\\%03d", c)
+		default:
+			builder.WriteByte(c)
+		}
+	}
+	builder.WriteByte('"')
+	return builder.String()
+}
@@ -0,0 +1,28 @@
+package dns
+
+import (
+	"context"
+	"net"
+)
+
+// ListenPacketReusePort opens count UDP sockets bound to the same address
+// with SO_REUSEPORT. The kernel hashes each client onto one of them, so
+// serving every socket from its own goroutine spreads load across cores.
+// A zero port is resolved by the first socket and shared by the rest.
+func ListenPacketReusePort(network, address string, count int) ([]net.PacketConn, error) {
+	config := net.ListenConfig{Control: reusePortControl}
+
+	var packetConns []net.PacketConn
+	for i := 0; i < count; i++ {
+		packetConn, err := config.ListenPacket(context.Background(), network, address)
+		if err != nil {
+			for _, opened := range packetConns {
+				opened.Close()
+			}
+			return nil, err
+		}
+		packetConns = append(packetConns, packetConn)
+		address = packetConn.LocalAddr().String()
+	}
+	return packetConns, nil
+}
@@ -0,0 +1,20 @@
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le
+
+package dns
+
+import "syscall"
+
+// The syscall package has no SO_REUSEPORT on Linux; it is 15 everywhere but
+// MIPS.
+const soReusePort = 0xf
+
+func reusePortControl(network, address string, rawConn syscall.RawConn) error {
+	var sockoptErr error
+	err := rawConn.Control(func(fd uintptr) {
+		sockoptErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return sockoptErr
+}
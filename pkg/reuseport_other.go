@@ -0,0 +1,12 @@
+//go:build !linux || mips || mipsle || mips64 || mips64le
+
+package dns
+
+import (
+	"errors"
+	"syscall"
+)
+
+func reusePortControl(network, address string, rawConn syscall.RawConn) error {
+	return errors.New("SO_REUSEPORT is not supported on this platform")
+}
@@ -1,43 +1,493 @@
 package dns
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
 	UDPMaxMessageSize uint = 512
+
+	defaultWorkers       = 64
+	defaultMaxInFlight   = 1024
+	defaultMaxTCPQueries = 16
 )
 
-func Serve() {
+var ErrServerClosed = errors.New("dns: server closed")
+
+type Server struct {
+	// Addr is the address to listen on, ":53" if empty. Addrs lists several
+	// addresses to listen on at once and takes precedence over Addr.
+	Addr  string
+	Addrs []string
+	// Net is the network to listen on, "udp" if empty: "udp", "tcp" or
+	// "tcp-tls", optionally with a 4 or 6 suffix on the protocol.
+	Net     string
+	Handler Handler
+
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	// ReadBufferSize and WriteBufferSize set the socket buffer sizes when
+	// non-zero.
+	ReadBufferSize  int
+	WriteBufferSize int
+
+	EDNS *EDNSConfig
+	// Authoritative sets AA on the replies the server builds itself, such as
+	// FORMERR and NOTIMP; handlers set AA on their own answers.
+	// RecursionAvailable sets RA on every reply.
+	Authoritative      bool
+	RecursionAvailable bool
+
+	// IdleTimeout closes TCP connections with no outstanding queries. It
+	// defaults to the keepalive timeout advertised through EDNS.
+	IdleTimeout time.Duration
+	// MaxTCPConnections limits concurrent TCP connections when non-zero.
+	MaxTCPConnections int
+	// MaxTCPQueries bounds how many queries on one TCP or TLS connection
+	// are answered at once, 16 if zero. Further queries are not read until
+	// an earlier one has been answered.
+	MaxTCPQueries int
+
+	// ReusePort opens this many UDP sockets on each address with
+	// SO_REUSEPORT, each with its own reader, so the kernel spreads queries
+	// across cores. Values below 2 open a single socket.
+	ReusePort int
+
+	// ProxyTrusted lists the load balancers allowed to prefix connections
+	// and datagrams with a PROXY protocol v2 header. Handlers then see the
+	// client address from the header instead of the balancer's.
+	ProxyTrusted []*net.IPNet
+
+	// Workers answer UDP queries concurrently, 64 if zero. MaxInFlight
+	// bounds how many UDP queries may be queued or being answered, 1024 if
+	// zero.
+	Workers     int
+	MaxInFlight int
+
+	// TLSConfig is used when Net is "tcp-tls".
+	TLSConfig *tls.Config
+
+	// PacketConn and Listener are served by ListenAndServe instead of
+	// opening Addr.
+	PacketConn net.PacketConn
+	Listener   net.Listener
+
+	mu        sync.Mutex
+	closed    bool
+	listeners map[io.Closer]struct{}
+	conns     map[net.Conn]struct{}
+	serving   sync.WaitGroup
+	dropped   atomic.Uint64
+	malformed atomic.Uint64
+}
+
+func (s *Server) handler() Handler {
+	if s.Handler != nil {
+		return s.Handler
+	}
+	return DefaultServeMux
+}
+
+func (s *Server) edns() *EDNSConfig {
+	if s.EDNS != nil {
+		return s.EDNS
+	}
+	return DefaultEDNSConfig
+}
+
+// ListenAndServe listens on Addr, or on every address in Addrs, and serves
+// them all until one fails or the server is shut down.
+func (s *Server) ListenAndServe() error {
+	if s.PacketConn != nil {
+		return s.Serve(s.PacketConn)
+	}
+	if s.Listener != nil {
+		if strings.HasSuffix(s.Net, "-tls") {
+			return s.ServeTLS(s.Listener, s.TLSConfig)
+		}
+		return s.ServeTCP(s.Listener)
+	}
+
+	network := s.Net
+	if network == "" {
+		network = "udp"
+	}
+
+	addrs := s.Addrs
+	if len(addrs) == 0 {
+		addr := s.Addr
+		if addr == "" {
+			addr = ":53"
+		}
+		addrs = []string{addr}
+	}
+
+	// Every address is bound before any is served so a typo fails fast
+	var serves []func() error
+	var opened []io.Closer
+	for _, addr := range addrs {
+		serve, listeners, err := s.listen(network, addr)
+		if err != nil {
+			for _, listener := range opened {
+				listener.Close()
+			}
+			return err
+		}
+		serves = append(serves, serve...)
+		opened = append(opened, listeners...)
+	}
+
+	if len(serves) == 1 {
+		return serves[0]()
+	}
+
+	errs := make(chan error, len(serves))
+	for _, serve := range serves {
+		go func() { errs <- serve() }()
+	}
+
+	err := <-errs
+	if !errors.Is(err, ErrServerClosed) {
+		// One listener failing takes the others down with it
+		s.Shutdown(context.Background())
+	}
+	for i := 1; i < len(serves); i++ {
+		<-errs
+	}
+	return err
+}
+
+func (s *Server) listen(network, addr string) ([]func() error, []io.Closer, error) {
+	switch network {
+	case "udp", "udp4", "udp6":
+		if s.ReusePort > 1 {
+			packetConns, err := ListenPacketReusePort(network, addr, s.ReusePort)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to bind to address %s: %v", addr, err)
+			}
+			var serves []func() error
+			var listeners []io.Closer
+			for _, packetConn := range packetConns {
+				serves = append(serves, func() error { return s.Serve(packetConn) })
+				listeners = append(listeners, packetConn)
+			}
+			return serves, listeners, nil
+		}
+
+		packetConn, err := net.ListenPacket(network, addr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to bind to address %s: %v", addr, err)
+		}
+		return []func() error{func() error { return s.Serve(packetConn) }}, []io.Closer{packetConn}, nil
+	case "tcp", "tcp4", "tcp6":
+		listener, err := net.Listen(network, addr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to bind to address %s: %v", addr, err)
+		}
+		return []func() error{func() error { return s.ServeTCP(listener) }}, []io.Closer{listener}, nil
+	case "tcp-tls", "tcp4-tls", "tcp6-tls":
+		if s.TLSConfig == nil {
+			return nil, nil, errors.New("DNS over TLS requires a TLS config")
+		}
+		listener, err := net.Listen(strings.TrimSuffix(network, "-tls"), addr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to bind to address %s: %v", addr, err)
+		}
+		return []func() error{func() error { return s.ServeTLS(listener, s.TLSConfig) }}, []io.Closer{listener}, nil
+	}
+
+	return nil, nil, fmt.Errorf("unsupported network %q", network)
+}
+
+// Serve answers queries arriving on packetConn until it fails or the server
+// is shut down. Queries are handed to a pool of workers so a slow handler
+// only holds up its own client; once MaxInFlight queries are waiting or
+// being answered, further packets are dropped and counted. The connection is
+// closed when Serve returns.
+func (s *Server) Serve(packetConn net.PacketConn) error {
+	if !s.trackListener(packetConn) {
+		packetConn.Close()
+		return ErrServerClosed
+	}
+	defer s.serving.Done()
+	defer s.untrackListener(packetConn)
+	defer packetConn.Close()
+
+	s.setBufferSizes(packetConn)
+
+	maxInFlight := s.maxInFlight()
+	slots := make(chan struct{}, maxInFlight)
+	packets := make(chan packet, maxInFlight)
+
+	var workers sync.WaitGroup
+	for i := 0; i < s.workers(); i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for p := range packets {
+				s.servePacket(packetConn, p)
+				putBuffer(p.buffer)
+				<-slots
+			}
+		}()
+	}
+	// Queries already read are still answered before the connection closes
+	defer workers.Wait()
+	defer close(packets)
 
-	udpAddr, err := net.ResolveUDPAddr("udp", "127.0.0.1:2053")
+	udpConn, packetInfo := packetInfoConn(packetConn)
+	oob := make([]byte, packetInfoSize)
+
+	for {
+		if s.ReadTimeout > 0 {
+			packetConn.SetReadDeadline(time.Now().Add(s.ReadTimeout))
+		}
+		// Checked after the deadline is set so Shutdown cannot be overridden
+		if s.isClosed() {
+			return ErrServerClosed
+		}
+
+		// Queries are read whole even when larger than the payload size we offer
+		buffer := getBuffer()
+		var p packet
+		var err error
+		if packetInfo {
+			p, err = readPacketInfo(udpConn, buffer, oob)
+		} else {
+			p.buffer = buffer
+			p.size, p.source, err = packetConn.ReadFrom(*buffer)
+		}
+		if err != nil {
+			putBuffer(buffer)
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return fmt.Errorf("error receiving data: %v", err)
+		}
+
+		select {
+		case slots <- struct{}{}:
+			packets <- p
+		default:
+			putBuffer(buffer)
+			s.dropped.Add(1)
+		}
+	}
+}
+
+type packet struct {
+	buffer *[]byte
+	size   int
+	source net.Addr
+	// local and control are only set when the socket reports packet info
+	local   net.Addr
+	control []byte
+}
+
+// packetInfoSize fits both packet info control messages: a dual-stack
+// socket receives IPV6_PKTINFO (40 octets) and IP_PKTINFO (32 octets) for
+// every IPv4 query, and a smaller buffer truncates the second.
+const packetInfoSize = 128
+
+// packetInfoConn reports whether replies on packetConn need the packet info
+// of each query to leave from the right address: on a wildcard bind the
+// kernel would otherwise pick the source address of every reply itself.
+func packetInfoConn(packetConn net.PacketConn) (*net.UDPConn, bool) {
+	udpConn, ok := packetConn.(*net.UDPConn)
+	if !ok {
+		return nil, false
+	}
+	local, ok := udpConn.LocalAddr().(*net.UDPAddr)
+	if !ok || !local.IP.IsUnspecified() {
+		return nil, false
+	}
+	return udpConn, enablePacketInfo(udpConn)
+}
+
+func readPacketInfo(udpConn *net.UDPConn, buffer *[]byte, oob []byte) (packet, error) {
+	size, oobSize, _, source, err := udpConn.ReadMsgUDP(*buffer, oob)
+	p := packet{buffer: buffer, size: size, source: source}
 	if err != nil {
-		fmt.Println("Failed to resolve UDP address:", err)
+		return p, err
+	}
+
+	if destination := parsePacketInfo(oob[:oobSize]); destination != nil {
+		port := udpConn.LocalAddr().(*net.UDPAddr).Port
+		p.local = &net.UDPAddr{IP: destination, Port: port}
+		p.control = packetInfoControl(destination)
+	}
+	return p, nil
+}
+
+func (s *Server) servePacket(packetConn net.PacketConn, p packet) {
+	local := p.local
+	if local == nil {
+		local = packetConn.LocalAddr()
+	}
+
+	// Replies still go to the balancer the datagram came from
+	local, source, requestBuffer, ok := s.proxyPacket(local, p.source, (*p.buffer)[:p.size])
+	if !ok {
 		return
 	}
 
-	udpConn, err := net.ListenUDP("udp", udpAddr)
-	if err != nil {
-		fmt.Println("Failed to bind to address:", err)
+	responseBuffer := s.handlePacket(local, source, requestBuffer, false)
+	if responseBuffer == nil {
 		return
 	}
-	defer udpConn.Close()
 
-	requestBuffer := make([]byte, UDPMaxMessageSize)
+	if s.WriteTimeout > 0 {
+		packetConn.SetWriteDeadline(time.Now().Add(s.WriteTimeout))
+	}
 
-	for {
-		size, source, err := udpConn.ReadFromUDP(requestBuffer)
-		if err != nil {
-			fmt.Println("Error receiving data:", err)
-			break
+	var err error
+	if p.control != nil {
+		_, _, err = packetConn.(*net.UDPConn).WriteMsgUDP(responseBuffer, p.control, p.source.(*net.UDPAddr))
+	} else {
+		_, err = packetConn.WriteTo(responseBuffer, p.source)
+	}
+	if err != nil {
+		fmt.Println("Failed to send response:", err)
+	}
+}
+
+// Dropped reports how many UDP queries were discarded because MaxInFlight
+// queries were already waiting or being answered.
+func (s *Server) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Malformed reports how many queries could not be parsed. They are answered
+// with FORMERR when enough of the header survived. Datagrams dropped for a
+// malformed PROXY protocol header are counted too.
+func (s *Server) Malformed() uint64 {
+	return s.malformed.Load()
+}
+
+func (s *Server) workers() int {
+	if s.Workers > 0 {
+		return s.Workers
+	}
+	return defaultWorkers
+}
+
+func (s *Server) maxInFlight() int {
+	if s.MaxInFlight > 0 {
+		return s.MaxInFlight
+	}
+	return defaultMaxInFlight
+}
+
+var bufferPool = sync.Pool{
+	New: func() any {
+		buffer := make([]byte, MaxMessageSize)
+		return &buffer
+	},
+}
+
+func getBuffer() *[]byte { return bufferPool.Get().(*[]byte) }
+
+func putBuffer(buffer *[]byte) { bufferPool.Put(buffer) }
+
+// Shutdown stops reading from every listener and connection and waits for
+// queries already being answered to finish, or for ctx to expire.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	for listener := range s.listeners {
+		// Packet listeners stay open so queued responses can still be sent
+		if packetConn, ok := listener.(net.PacketConn); ok {
+			packetConn.SetReadDeadline(time.Now())
+			continue
 		}
+		listener.Close()
+	}
+	for conn := range s.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	s.mu.Unlock()
 
-		responseBuffer := HandleDnsRequest(udpConn, source, requestBuffer[:size])
+	done := make(chan struct{})
+	go func() {
+		s.serving.Wait()
+		close(done)
+	}()
 
-		_, err = udpConn.WriteToUDP(responseBuffer, source)
-		if err != nil {
-			fmt.Println("Failed to send response:", err)
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Server) trackListener(listener io.Closer) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[io.Closer]struct{})
+	}
+	s.listeners[listener] = struct{}{}
+	s.serving.Add(1)
+	return true
+}
+
+func (s *Server) untrackListener(listener io.Closer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.listeners, listener)
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+func (s *Server) setBufferSizes(conn any) {
+	type bufferSetter interface {
+		SetReadBuffer(bytes int) error
+		SetWriteBuffer(bytes int) error
+	}
+
+	setter, ok := conn.(bufferSetter)
+	if !ok {
+		return
+	}
+	if s.ReadBufferSize > 0 {
+		if err := setter.SetReadBuffer(s.ReadBufferSize); err != nil {
+			fmt.Println("Failed to set read buffer size:", err)
+		}
+	}
+	if s.WriteBufferSize > 0 {
+		if err := setter.SetWriteBuffer(s.WriteBufferSize); err != nil {
+			fmt.Println("Failed to set write buffer size:", err)
 		}
 	}
 }
+
+// Serve listens on 127.0.0.1:2053 with the DefaultServeMux.
+func Serve() {
+	server := &Server{Addr: "127.0.0.1:2053", Net: "udp"}
+	if err := server.ListenAndServe(); err != nil {
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,185 @@
+package dns
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const defaultIdleTimeout = 10 * time.Second
+
+// ServeTCP accepts connections on listener until it fails or the server is
+// shut down. Each connection may carry several queries, which are answered
+// concurrently and possibly out of order (RFC 7766 section 6.2.1.1).
+func (s *Server) ServeTCP(listener net.Listener) error {
+	return s.serveStream(s.proxyListener(listener))
+}
+
+func (s *Server) serveStream(listener net.Listener) error {
+	if !s.trackListener(listener) {
+		listener.Close()
+		return ErrServerClosed
+	}
+	defer s.serving.Done()
+	defer s.untrackListener(listener)
+	defer listener.Close()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return fmt.Errorf("error accepting connection: %v", err)
+		}
+
+		if !s.trackConn(conn) {
+			conn.Close()
+			continue
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.serving.Done()
+	defer s.untrackConn(conn)
+	defer conn.Close()
+
+	s.setBufferSizes(conn)
+
+	var (
+		writeMu  sync.Mutex
+		inFlight sync.WaitGroup
+		pending  int
+		idle     = s.idleTimeout()
+		slots    = make(chan struct{}, s.maxTCPQueries())
+	)
+	_, encrypted := conn.(*tls.Conn)
+	// Responses may still be written after the last query has been read
+	defer inFlight.Wait()
+
+	// read counts length octets already received, which survive an idle
+	// timeout that fires between the two
+	var length [2]byte
+	read := 0
+	for {
+		// A client pipelining faster than it is answered waits here, so it
+		// cannot pile up goroutines and buffers
+		slots <- struct{}{}
+
+		conn.SetReadDeadline(time.Now().Add(idle))
+		// Checked after the deadline is set so Shutdown cannot be overridden
+		if s.isClosed() {
+			return
+		}
+		n, err := io.ReadFull(conn, length[read:])
+		read += n
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() && !s.isClosed() {
+				// Only connections without outstanding queries count as idle
+				writeMu.Lock()
+				busy := pending > 0
+				writeMu.Unlock()
+				if busy {
+					<-slots
+					continue
+				}
+			}
+			return
+		}
+		read = 0
+
+		size := binary.BigEndian.Uint16(length[:])
+		if size == 0 {
+			return
+		}
+
+		if s.ReadTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(s.ReadTimeout))
+		}
+		requestBuffer := make([]byte, size)
+		if _, err := io.ReadFull(conn, requestBuffer); err != nil {
+			return
+		}
+
+		writeMu.Lock()
+		pending++
+		writeMu.Unlock()
+
+		inFlight.Add(1)
+		go func() {
+			defer inFlight.Done()
+			defer func() { <-slots }()
+
+			responseBuffer := s.handlePacket(conn.LocalAddr(), conn.RemoteAddr(), requestBuffer, encrypted)
+
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			pending--
+
+			if responseBuffer == nil {
+				return
+			}
+			if s.WriteTimeout > 0 {
+				conn.SetWriteDeadline(time.Now().Add(s.WriteTimeout))
+			}
+			framed := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(responseBuffer)), uint16(len(responseBuffer)))
+			if _, err := conn.Write(append(framed, responseBuffer...)); err != nil {
+				fmt.Println("Failed to send response:", err)
+			}
+		}()
+	}
+}
+
+func (s *Server) idleTimeout() time.Duration {
+	if s.IdleTimeout > 0 {
+		return s.IdleTimeout
+	}
+	// Closing sooner than the advertised keepalive would surprise clients
+	if timeout := s.edns().KeepaliveTimeout; timeout > 0 {
+		return timeout
+	}
+	return defaultIdleTimeout
+}
+
+func (s *Server) maxTCPQueries() int {
+	if s.MaxTCPQueries > 0 {
+		return s.MaxTCPQueries
+	}
+	return defaultMaxTCPQueries
+}
+
+func (s *Server) trackConn(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+	if s.MaxTCPConnections > 0 && len(s.conns) >= s.MaxTCPConnections {
+		return false
+	}
+	if s.conns == nil {
+		s.conns = make(map[net.Conn]struct{})
+	}
+	s.conns[conn] = struct{}{}
+	s.serving.Add(1)
+	return true
+}
+
+func (s *Server) untrackConn(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+}
@@ -0,0 +1,119 @@
+package dns
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// ServeTLS answers DNS over TLS (RFC 7858) on listener, with the same
+// framing, pipelining and idle handling as ServeTCP. Responses to EDNS
+// queries are always padded. config should be shared between listeners and
+// not copied per connection so session tickets stay valid and resumption
+// works.
+func (s *Server) ServeTLS(listener net.Listener, config *tls.Config) error {
+	if config == nil {
+		listener.Close()
+		return errors.New("DNS over TLS requires a TLS config")
+	}
+	// PROXY protocol headers come before the TLS handshake
+	return s.serveStream(tls.NewListener(s.proxyListener(listener), config))
+}
+
+// NewTLSConfig returns a server configuration for DNS over TLS that takes
+// its certificate from reloader. Session tickets are left enabled so clients
+// can resume sessions.
+func NewTLSConfig(reloader *CertificateReloader) *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+		NextProtos:     []string{"dot"},
+	}
+}
+
+// CertificateReloader serves a certificate and key from disk and picks up
+// replacements without a restart: either when Reload is called, or on the
+// next handshake after either file changes. Both files must stay readable by
+// the user the process runs as, which matters after DropPrivileges.
+type CertificateReloader struct {
+	CertFile string
+	KeyFile  string
+
+	mu          sync.RWMutex
+	certificate *tls.Certificate
+	certModTime time.Time
+	keyModTime  time.Time
+	// failed holds the modification times of a pair that did not load, so
+	// handshakes retry and report it only once the files change again
+	failedCertModTime time.Time
+	failedKeyModTime  time.Time
+}
+
+func NewCertificateReloader(certFile, keyFile string) (*CertificateReloader, error) {
+	reloader := &CertificateReloader{CertFile: certFile, KeyFile: keyFile}
+	if err := reloader.Reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// Reload reads the certificate and key again. On failure the previous
+// certificate stays in use.
+func (r *CertificateReloader) Reload() error {
+	certModTime, keyModTime, err := r.modTimes()
+	if err != nil {
+		return err
+	}
+
+	certificate, err := tls.LoadX509KeyPair(r.CertFile, r.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %v", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.certificate = &certificate
+	r.certModTime = certModTime
+	r.keyModTime = keyModTime
+	return nil
+}
+
+func (r *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if certModTime, keyModTime, err := r.modTimes(); err == nil {
+		r.mu.RLock()
+		changed := !certModTime.Equal(r.certModTime) || !keyModTime.Equal(r.keyModTime)
+		failed := certModTime.Equal(r.failedCertModTime) && keyModTime.Equal(r.failedKeyModTime)
+		r.mu.RUnlock()
+
+		// A half-written pair fails to load and is retried once writing it
+		// finishes and the modification times move on
+		if changed && !failed {
+			if err := r.Reload(); err != nil {
+				fmt.Println("Failed to reload certificate:", err)
+				r.mu.Lock()
+				r.failedCertModTime, r.failedKeyModTime = certModTime, keyModTime
+				r.mu.Unlock()
+			}
+		}
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.certificate, nil
+}
+
+func (r *CertificateReloader) modTimes() (time.Time, time.Time, error) {
+	certInfo, err := os.Stat(r.CertFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	keyInfo, err := os.Stat(r.KeyFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
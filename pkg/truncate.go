@@ -0,0 +1,46 @@
+package dns
+
+// Truncate packs m into at most size octets, removing whole RRsets from the
+// end of the message until it fits (RFC 2181 section 9). Dropping additional
+// records leaves TC clear since the client can do without them; dropping
+// anything from the answer or authority sections sets TC. The question and
+// OPT record are always kept.
+func (m *Message) Truncate(size int) ([]byte, error) {
+	packed, err := m.Pack()
+	if err != nil || len(packed) <= size {
+		return packed, err
+	}
+
+	for _, section := range []*[]DNSAnswer{&m.Additional, &m.Authority, &m.Answer} {
+		for len(*section) > 0 {
+			*section = withoutLastRRset(*section)
+			if section != &m.Additional {
+				m.Flags.TC = true
+			}
+
+			if packed, err = m.Pack(); err != nil || len(packed) <= size {
+				return packed, err
+			}
+		}
+	}
+
+	// Only the header, question and OPT record are left
+	m.Flags.TC = true
+	return m.Pack()
+}
+
+// withoutLastRRset removes every record sharing the owner name, type and class
+// of the last record, keeping the order of the rest.
+func withoutLastRRset(records []DNSAnswer) []DNSAnswer {
+	last := records[len(records)-1]
+	name := canonicalName(last.Name)
+
+	kept := records[:0:0]
+	for _, record := range records {
+		if record.Type == last.Type && record.Class == last.Class && canonicalName(record.Name) == name {
+			continue
+		}
+		kept = append(kept, record)
+	}
+	return kept
+}
@@ -0,0 +1,43 @@
+package dns
+
+const (
+	TypeA     uint16 = 1
+	TypeNS    uint16 = 2
+	TypeCNAME uint16 = 5
+	TypeSOA   uint16 = 6
+	TypePTR   uint16 = 12
+	TypeMX    uint16 = 15
+	TypeTXT   uint16 = 16
+	TypeAAAA  uint16 = 28
+	TypeSRV   uint16 = 33
+	TypeOPT   uint16 = 41
+	TypeANY   uint16 = 255
+)
+
+const (
+	ClassIN  uint16 = 1
+	ClassCH  uint16 = 3
+	ClassHS  uint16 = 4
+	ClassANY uint16 = 255
+)
+
+var typeNames = map[uint16]string{
+	TypeA:     "A",
+	TypeNS:    "NS",
+	TypeCNAME: "CNAME",
+	TypeSOA:   "SOA",
+	TypePTR:   "PTR",
+	TypeMX:    "MX",
+	TypeTXT:   "TXT",
+	TypeAAAA:  "AAAA",
+	TypeSRV:   "SRV",
+	TypeOPT:   "OPT",
+	TypeANY:   "ANY",
+}
+
+var classNames = map[uint16]string{
+	ClassIN:  "IN",
+	ClassCH:  "CH",
+	ClassHS:  "HS",
+	ClassANY: "ANY",
+}
@@ -0,0 +1,82 @@
+package dns
+
+import (
+	"bytes"
+	"fmt"
+)
+
+const maxCompressionOffset = 0x3FFF
+
+type MessageWriter struct {
+	buffer      *bytes.Buffer
+	compression map[string]int
+}
+
+// NewMessageWriter expects buffer to hold the message from its first byte, as
+// compression pointers are taken from the buffer length.
+func NewMessageWriter(buffer *bytes.Buffer) *MessageWriter {
+	return &MessageWriter{
+		buffer:      buffer,
+		compression: make(map[string]int),
+	}
+}
+
+func (w *MessageWriter) Len() int {
+	return w.buffer.Len()
+}
+
+func (w *MessageWriter) Bytes() []byte {
+	return w.buffer.Bytes()
+}
+
+func (w *MessageWriter) WriteName(name []byte) error {
+	return w.writeName(name, true)
+}
+
+func (w *MessageWriter) WriteUncompressedName(name []byte) error {
+	return w.writeName(name, false)
+}
+
+func (w *MessageWriter) writeName(name []byte, compress bool) error {
+	if len(name) == 0 {
+		return fmt.Errorf("empty domain name")
+	}
+	if len(name) > MaxDomainNameLength {
+		return fmt.Errorf("domain name exceeds %d octets", MaxDomainNameLength)
+	}
+
+	for i := 0; i < len(name); {
+		length := int(name[i])
+		if length == 0 {
+			break
+		}
+		if length > 63 {
+			return fmt.Errorf("invalid label length %d", length)
+		}
+		if i+1+length >= len(name) {
+			return fmt.Errorf("domain name is not terminated")
+		}
+
+		suffix := string(name[i:])
+		if compress {
+			if offset, ok := w.compression[suffix]; ok {
+				w.buffer.WriteByte(byte(0xC0 | offset>>8))
+				w.buffer.WriteByte(byte(offset))
+				return nil
+			}
+		}
+
+		// Record every suffix so later names can point here, even if this one
+		// must be written in full
+		if offset := w.buffer.Len(); offset <= maxCompressionOffset {
+			if _, ok := w.compression[suffix]; !ok {
+				w.compression[suffix] = offset
+			}
+		}
+
+		w.buffer.Write(name[i : i+1+length])
+		i += 1 + length
+	}
+
+	return w.buffer.WriteByte(0)
+}
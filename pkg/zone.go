@@ -0,0 +1,474 @@
+package dns
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxIncludeDepth stops $INCLUDE loops.
+	maxIncludeDepth = 8
+
+	// maxGenerate caps how many records one $GENERATE may produce.
+	maxGenerate = 65536
+)
+
+// ZoneError reports where in a zone file parsing failed.
+type ZoneError struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *ZoneError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+	}
+	return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+}
+
+func (e *ZoneError) Unwrap() error { return e.Err }
+
+// ParseZone reads a master file (RFC 1035 section 5) and returns its records
+// in order. Relative names are completed with origin, which $ORIGIN may
+// change; an empty origin means the root. $INCLUDE paths are relative to the
+// working directory.
+func ParseZone(r io.Reader, origin string) ([]DNSAnswer, error) {
+	parser, err := newZoneParser(origin, "", ".")
+	if err != nil {
+		return nil, err
+	}
+	if err := parser.parse(r); err != nil {
+		return nil, err
+	}
+	return parser.records, nil
+}
+
+// ParseZoneFile is ParseZone for a file on disk. $INCLUDE paths are relative
+// to the directory holding filename.
+func ParseZoneFile(filename, origin string) ([]DNSAnswer, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	parser, err := newZoneParser(origin, filename, filepath.Dir(filename))
+	if err != nil {
+		return nil, err
+	}
+	if err := parser.parse(file); err != nil {
+		return nil, err
+	}
+	return parser.records, nil
+}
+
+// zoneParser holds the state that carries from one entry to the next: the
+// origin, the default TTL and the owner, TTL and class of the last record.
+type zoneParser struct {
+	file  string
+	dir   string
+	depth int
+
+	origin     []byte
+	defaultTTL uint32
+	hasDefault bool
+	lastTTL    uint32
+	hasLastTTL bool
+	lastClass  uint16
+	lastOwner  []byte
+
+	records []DNSAnswer
+}
+
+func newZoneParser(origin, file, dir string) (*zoneParser, error) {
+	if origin == "" {
+		origin = "."
+	}
+	name, err := ParseName(origin)
+	if err != nil {
+		return nil, fmt.Errorf("invalid origin: %v", err)
+	}
+	return &zoneParser{file: file, dir: dir, origin: name, lastClass: ClassIN}, nil
+}
+
+func (p *zoneParser) parse(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, MaxMessageSize)
+
+	var entry strings.Builder
+	lineNumber, start, depth := 0, 0, 0
+	indented := false
+
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if depth == 0 {
+			start = lineNumber
+			indented = len(line) > 0 && (line[0] == ' ' || line[0] == '\t')
+			entry.Reset()
+		}
+
+		var err error
+		if depth, err = stripZoneLine(line, depth, &entry); err != nil {
+			return p.errorAt(lineNumber, err)
+		}
+		if depth > 0 {
+			entry.WriteByte(' ')
+			continue
+		}
+
+		if err := p.entry(entry.String(), indented); err != nil {
+			return p.errorAt(start, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return p.errorAt(lineNumber+1, err)
+	}
+	if depth > 0 {
+		return p.errorAt(start, fmt.Errorf("unbalanced parentheses"))
+	}
+	return nil
+}
+
+func (p *zoneParser) errorAt(line int, err error) error {
+	// Errors from an included file already say where they happened
+	if _, ok := err.(*ZoneError); ok {
+		return err
+	}
+	return &ZoneError{File: p.file, Line: line, Err: err}
+}
+
+// stripZoneLine copies line into entry without its comment, turning the
+// parentheses that group an entry across lines into spaces. It returns the
+// nesting depth at the end of the line.
+func stripZoneLine(line string, depth int, entry *strings.Builder) (int, error) {
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\' && i+1 < len(line):
+			entry.WriteByte(c)
+			entry.WriteByte(line[i+1])
+			i++
+		case c == '"':
+			quoted = !quoted
+			entry.WriteByte(c)
+		case quoted:
+			entry.WriteByte(c)
+		case c == ';':
+			return depth, nil
+		case c == '(':
+			depth++
+			entry.WriteByte(' ')
+		case c == ')':
+			if depth == 0 {
+				return 0, fmt.Errorf("unbalanced parentheses")
+			}
+			depth--
+			entry.WriteByte(' ')
+		default:
+			entry.WriteByte(c)
+		}
+	}
+	if quoted {
+		return depth, fmt.Errorf("unterminated quoted string")
+	}
+	return depth, nil
+}
+
+func (p *zoneParser) entry(text string, indented bool) error {
+	fields, err := splitFields(text)
+	if err != nil || len(fields) == 0 {
+		return err
+	}
+
+	if !indented && strings.HasPrefix(fields[0], "$") {
+		return p.directive(fields)
+	}
+	if indented {
+		return p.record(nil, fields)
+	}
+	return p.record(&fields[0], fields[1:])
+}
+
+func (p *zoneParser) directive(fields []string) error {
+	switch strings.ToUpper(fields[0]) {
+	case "$ORIGIN":
+		if len(fields) != 2 {
+			return fmt.Errorf("$ORIGIN needs one name")
+		}
+		origin, err := parseRelativeName(fields[1], p.origin)
+		if err != nil {
+			return err
+		}
+		p.origin = origin
+	case "$TTL":
+		if len(fields) != 2 {
+			return fmt.Errorf("$TTL needs one value")
+		}
+		ttl, err := parseTTL(fields[1])
+		if err != nil {
+			return err
+		}
+		p.defaultTTL, p.hasDefault = ttl, true
+	case "$INCLUDE":
+		if len(fields) != 2 && len(fields) != 3 {
+			return fmt.Errorf("$INCLUDE needs a file name and optionally an origin")
+		}
+		return p.include(fields[1:])
+	case "$GENERATE":
+		return p.generate(fields[1:])
+	default:
+		return fmt.Errorf("unknown directive %s", fields[0])
+	}
+	return nil
+}
+
+// include parses another file as if it were part of this one. The origin and
+// the inherited owner, TTL and class do not leak back out of it.
+func (p *zoneParser) include(fields []string) error {
+	if p.depth >= maxIncludeDepth {
+		return fmt.Errorf("$INCLUDE nested more than %d deep", maxIncludeDepth)
+	}
+
+	path, err := unquoteString(fields[0])
+	if err != nil {
+		return err
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(p.dir, path)
+	}
+
+	child := *p
+	child.file, child.dir, child.depth = path, filepath.Dir(path), p.depth+1
+	child.records = nil
+	if len(fields) == 2 {
+		if child.origin, err = parseRelativeName(fields[1], p.origin); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := child.parse(file); err != nil {
+		return err
+	}
+	p.records = append(p.records, child.records...)
+	return nil
+}
+
+// generate expands BIND's "$GENERATE start-stop[/step] lhs [ttl] [class]
+// type rhs", substituting the iterator for each $ in lhs and rhs.
+func (p *zoneParser) generate(fields []string) error {
+	if len(fields) < 4 {
+		return fmt.Errorf("$GENERATE needs a range, owner, type and data")
+	}
+
+	start, stop, step, err := parseGenerateRange(fields[0])
+	if err != nil {
+		return err
+	}
+	if (stop-start)/step >= maxGenerate {
+		return fmt.Errorf("$GENERATE range produces more than %d records", maxGenerate)
+	}
+
+	for i := start; i <= stop; i += step {
+		expanded := make([]string, len(fields)-1)
+		for j, field := range fields[1:] {
+			if expanded[j], err = expandGenerate(field, i); err != nil {
+				return err
+			}
+		}
+		if err := p.record(&expanded[0], expanded[1:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseGenerateRange(field string) (start, stop, step int, err error) {
+	step = 1
+	bounds, stepText, hasStep := strings.Cut(field, "/")
+	if hasStep {
+		if step, err = strconv.Atoi(stepText); err != nil || step < 1 {
+			return 0, 0, 0, fmt.Errorf("invalid $GENERATE step %q", stepText)
+		}
+	}
+	startText, stopText, ok := strings.Cut(bounds, "-")
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("invalid $GENERATE range %q", field)
+	}
+	start, err1 := strconv.Atoi(startText)
+	stop, err2 := strconv.Atoi(stopText)
+	if err1 != nil || err2 != nil || start < 0 || stop < start {
+		return 0, 0, 0, fmt.Errorf("invalid $GENERATE range %q", field)
+	}
+	return start, stop, step, nil
+}
+
+// expandGenerate replaces $ with the iterator and ${offset,width,base} with
+// the iterator plus offset, zero padded to width, in base d, o, x or X. \$
+// is a literal dollar sign.
+func expandGenerate(field string, iterator int) (string, error) {
+	var builder strings.Builder
+	for i := 0; i < len(field); i++ {
+		c := field[i]
+		switch {
+		case c == '\\' && i+1 < len(field) && field[i+1] == '$':
+			builder.WriteByte('$')
+			i++
+		case c == '\\' && i+1 < len(field):
+			builder.WriteByte(c)
+			builder.WriteByte(field[i+1])
+			i++
+		case c == '$' && i+1 < len(field) && field[i+1] == '{':
+			end := strings.IndexByte(field[i:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated modifier in %q", field)
+			}
+			text, err := formatGenerate(field[i+2:i+end], iterator)
+			if err != nil {
+				return "", err
+			}
+			builder.WriteString(text)
+			i += end
+		case c == '$':
+			builder.WriteString(strconv.Itoa(iterator))
+		default:
+			builder.WriteByte(c)
+		}
+	}
+	return builder.String(), nil
+}
+
+func formatGenerate(modifier string, iterator int) (string, error) {
+	parts := strings.Split(modifier, ",")
+	if len(parts) > 3 {
+		return "", fmt.Errorf("invalid modifier ${%s}", modifier)
+	}
+
+	offset, width, base := 0, 0, "d"
+	var err error
+	if offset, err = strconv.Atoi(parts[0]); err != nil {
+		return "", fmt.Errorf("invalid offset in ${%s}", modifier)
+	}
+	if len(parts) > 1 {
+		if width, err = strconv.Atoi(parts[1]); err != nil || width < 0 {
+			return "", fmt.Errorf("invalid width in ${%s}", modifier)
+		}
+	}
+	if len(parts) > 2 {
+		base = parts[2]
+	}
+
+	switch base {
+	case "d", "o", "x", "X":
+		return fmt.Sprintf("%0*"+base, width, iterator+offset), nil
+	}
+	return "", fmt.Errorf("unsupported base %q in ${%s}", base, modifier)
+}
+
+// record parses "[owner] [ttl] [class] type rdata", where the TTL and class
+// may come in either order. A nil owner repeats the previous one.
+func (p *zoneParser) record(owner *string, fields []string) error {
+	var record DNSAnswer
+	var err error
+
+	if owner == nil {
+		if p.lastOwner == nil {
+			return fmt.Errorf("record has no owner name")
+		}
+		record.Name = p.lastOwner
+	} else if record.Name, err = parseRelativeName(*owner, p.origin); err != nil {
+		return err
+	}
+
+	hasTTL, hasClass := false, false
+	for len(fields) > 0 {
+		if !hasTTL && len(fields[0]) > 0 && isDigit(fields[0][0]) {
+			if record.TTL, err = parseTTL(fields[0]); err != nil {
+				return err
+			}
+			hasTTL = true
+		} else if class, err := StringToClass(fields[0]); err == nil && !hasClass {
+			record.Class, hasClass = class, true
+		} else {
+			break
+		}
+		fields = fields[1:]
+	}
+
+	if len(fields) == 0 {
+		return fmt.Errorf("missing record type")
+	}
+	if record.Type, err = StringToType(fields[0]); err != nil {
+		return err
+	}
+
+	if !hasClass {
+		record.Class = p.lastClass
+	}
+	// An explicit TTL wins, then $TTL, then the TTL of the previous record
+	switch {
+	case hasTTL:
+	case p.hasDefault:
+		record.TTL = p.defaultTTL
+	case p.hasLastTTL:
+		record.TTL = p.lastTTL
+	default:
+		return fmt.Errorf("record has no TTL and there is no $TTL")
+	}
+
+	if record.Data, err = parseRData(record.Type, fields[1:], p.origin); err != nil {
+		return err
+	}
+
+	p.lastOwner, p.lastClass = record.Name, record.Class
+	p.lastTTL, p.hasLastTTL = record.TTL, true
+	p.records = append(p.records, record)
+	return nil
+}
+
+// parseTTL accepts seconds or BIND style units such as 1h30m. The largest
+// TTL is 2^31 - 1 (RFC 2181 section 8).
+func parseTTL(field string) (uint32, error) {
+	if value, err := strconv.ParseUint(field, 10, 32); err == nil {
+		if value > 1<<31-1 {
+			return 0, fmt.Errorf("TTL %q is too large", field)
+		}
+		return uint32(value), nil
+	}
+
+	units := map[byte]uint64{'s': 1, 'm': 60, 'h': 3600, 'd': 86400, 'w': 604800}
+	var total, number uint64
+	digits := false
+	for i := 0; i < len(field); i++ {
+		c := field[i]
+		if isDigit(c) {
+			number = number*10 + uint64(c-'0')
+			digits = true
+		} else if unit, ok := units[c|0x20]; ok && digits {
+			total += number * unit
+			number, digits = 0, false
+		} else {
+			return 0, fmt.Errorf("invalid TTL %q", field)
+		}
+		if number > 1<<31-1 || total > 1<<31-1 {
+			return 0, fmt.Errorf("TTL %q is too large", field)
+		}
+	}
+	if digits {
+		return 0, fmt.Errorf("invalid TTL %q", field)
+	}
+	return uint32(total), nil
+}
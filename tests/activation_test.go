@@ -0,0 +1,115 @@
+//go:build unix
+
+package tests
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	dns "github.com/joegrn/dns/pkg"
+)
+
+// Both tests re-run the test binary so the child can inherit descriptors or
+// change its user without affecting the rest of the suite.
+const childEnv = "DNS_TEST_CHILD"
+
+func TestActivationListeners(t *testing.T) {
+	if os.Getenv(childEnv) == "activation" {
+		listeners, packetConns, err := dns.ActivationListeners()
+		if err != nil {
+			fmt.Println("error:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("listeners=%d packetConns=%d", len(listeners), len(packetConns))
+		for _, listener := range listeners {
+			fmt.Printf(" tcp=%s", listener.Addr())
+		}
+		for _, packetConn := range packetConns {
+			fmt.Printf(" udp=%s", packetConn.LocalAddr())
+		}
+		fmt.Printf(" env=%q", os.Getenv("LISTEN_FDS"))
+		os.Exit(0)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer listener.Close()
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket() error = %v", err)
+	}
+	defer packetConn.Close()
+
+	listenerFile, err := listener.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("File() error = %v", err)
+	}
+	defer listenerFile.Close()
+	packetFile, err := packetConn.(*net.UDPConn).File()
+	if err != nil {
+		t.Fatalf("File() error = %v", err)
+	}
+	defer packetFile.Close()
+
+	// LISTEN_PID must name the child itself, which only the shell knows
+	// before it execs the test binary
+	cmd := exec.Command("/bin/sh", "-c", `LISTEN_PID=$$ exec "$0" -test.run '^TestActivationListeners$'`, os.Args[0])
+	cmd.Env = append(os.Environ(), childEnv+"=activation", "LISTEN_FDS=2")
+	cmd.ExtraFiles = []*os.File{listenerFile, packetFile}
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("child failed: %v: %s", err, output)
+	}
+
+	want := fmt.Sprintf("listeners=1 packetConns=1 tcp=%s udp=%s env=\"\"", listener.Addr(), packetConn.LocalAddr())
+	if got := string(output); !strings.HasPrefix(got, want) {
+		t.Errorf("child output = %q, want %q", got, want)
+	}
+}
+
+func TestActivationListenersNotActivated(t *testing.T) {
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "2")
+
+	listeners, packetConns, err := dns.ActivationListeners()
+	if err != nil || len(listeners) != 0 || len(packetConns) != 0 {
+		t.Errorf("ActivationListeners() = %v, %v, %v, want nothing for another process", listeners, packetConns, err)
+	}
+}
+
+func TestDropPrivileges(t *testing.T) {
+	if os.Getenv(childEnv) == "privileges" {
+		if err := dns.DropPrivileges("nobody", ""); err != nil {
+			fmt.Println("error:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("uid=%d euid=%d", os.Getuid(), os.Geteuid())
+		os.Exit(0)
+	}
+
+	if os.Getuid() != 0 {
+		t.Skip("dropping privileges needs root")
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run", "^TestDropPrivileges$")
+	cmd.Env = append(os.Environ(), childEnv+"=privileges")
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("child failed: %v: %s", err, output)
+	}
+	if got := string(output); strings.HasPrefix(got, "uid=0") || !strings.HasPrefix(got, "uid=") {
+		t.Errorf("child output = %q, want a non-root uid", got)
+	}
+}
+
+func TestDropPrivilegesUnknownUser(t *testing.T) {
+	if err := dns.DropPrivileges("no-such-user-for-dns-tests", ""); err == nil {
+		t.Error("DropPrivileges() error = nil, want unknown user")
+	}
+}
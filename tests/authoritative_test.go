@@ -0,0 +1,225 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	dns "github.com/joegrn/dns/pkg"
+)
+
+const exampleZone = `$ORIGIN example.com.
+$TTL 3600
+@	SOA	ns1 hostmaster 1 7200 3600 1209600 300
+	NS	ns1
+ns1	A	192.0.2.1
+www	A	192.0.2.2
+	AAAA	2001:db8::2
+alias	CNAME	www
+chain	CNAME	alias
+missing	CNAME	nowhere
+away	CNAME	www.example.net.
+a.b.c	A	192.0.2.3
+*.wild	A	192.0.2.4
+	TXT	"wildcard"
+child	NS	ns.child
+ns.child	A	192.0.2.5
+`
+
+func newExampleZone(t *testing.T) *dns.Zone {
+	t.Helper()
+	records, err := dns.ParseZone(strings.NewReader(exampleZone), "")
+	if err != nil {
+		t.Fatalf("ParseZone() error = %v", err)
+	}
+	zone, err := dns.NewZone("example.com.", records)
+	if err != nil {
+		t.Fatalf("NewZone() error = %v", err)
+	}
+	return zone
+}
+
+func serveZone(t *testing.T, handler dns.Handler, name string, qtype uint16) *dns.Message {
+	t.Helper()
+	request := query(t, name)
+	request.Question[0].QType = qtype
+
+	writer := &recordingWriter{}
+	handler.ServeDNS(writer, request)
+	if writer.response == nil {
+		t.Fatalf("ServeDNS() wrote no response for %s", name)
+	}
+	return writer.response
+}
+
+func recordStrings(records []dns.DNSAnswer) []string {
+	var converted []string
+	for _, record := range records {
+		converted = append(converted, record.String())
+	}
+	return converted
+}
+
+func TestZoneAnswers(t *testing.T) {
+	zone := newExampleZone(t)
+
+	tests := []struct {
+		name      string
+		qname     string
+		qtype     uint16
+		wantRCode uint16
+		wantAA    bool
+		answer    []string
+		authority []string
+	}{
+		{
+			name: "Exact match", qname: "WWW.example.com.", qtype: dns.TypeA, wantAA: true,
+			answer: []string{"www.example.com.\t3600\tIN\tA\t192.0.2.2"},
+		},
+		{
+			name: "NODATA", qname: "www.example.com.", qtype: dns.TypeMX, wantAA: true,
+			authority: []string{"example.com.\t300\tIN\tSOA\tns1.example.com. hostmaster.example.com. 1 7200 3600 1209600 300"},
+		},
+		{
+			name: "NXDOMAIN", qname: "nope.example.com.", qtype: dns.TypeA, wantRCode: dns.RCodeNXDomain, wantAA: true,
+			authority: []string{"example.com.\t300\tIN\tSOA\tns1.example.com. hostmaster.example.com. 1 7200 3600 1209600 300"},
+		},
+		{
+			name: "Empty non-terminal is NODATA", qname: "b.c.example.com.", qtype: dns.TypeA, wantAA: true,
+			authority: []string{"example.com.\t300\tIN\tSOA\tns1.example.com. hostmaster.example.com. 1 7200 3600 1209600 300"},
+		},
+		{
+			name: "CNAME chain is followed", qname: "chain.example.com.", qtype: dns.TypeA, wantAA: true,
+			answer: []string{
+				"chain.example.com.\t3600\tIN\tCNAME\talias.example.com.",
+				"alias.example.com.\t3600\tIN\tCNAME\twww.example.com.",
+				"www.example.com.\t3600\tIN\tA\t192.0.2.2",
+			},
+		},
+		{
+			name: "CNAME to a missing name", qname: "missing.example.com.", qtype: dns.TypeA, wantRCode: dns.RCodeNXDomain, wantAA: true,
+			answer:    []string{"missing.example.com.\t3600\tIN\tCNAME\tnowhere.example.com."},
+			authority: []string{"example.com.\t300\tIN\tSOA\tns1.example.com. hostmaster.example.com. 1 7200 3600 1209600 300"},
+		},
+		{
+			name: "CNAME out of the zone", qname: "away.example.com.", qtype: dns.TypeA, wantAA: true,
+			answer: []string{"away.example.com.\t3600\tIN\tCNAME\twww.example.net."},
+		},
+		{
+			name: "Wildcard", qname: "anything.wild.example.com.", qtype: dns.TypeTXT, wantAA: true,
+			answer: []string{"anything.wild.example.com.\t3600\tIN\tTXT\t\"wildcard\""},
+		},
+		{
+			name: "Wildcard NODATA", qname: "anything.wild.example.com.", qtype: dns.TypeAAAA, wantAA: true,
+			authority: []string{"example.com.\t300\tIN\tSOA\tns1.example.com. hostmaster.example.com. 1 7200 3600 1209600 300"},
+		},
+		{
+			name: "ANY", qname: "www.example.com.", qtype: dns.TypeANY, wantAA: true,
+			answer: []string{"www.example.com.\t3600\tIN\tA\t192.0.2.2", "www.example.com.\t3600\tIN\tAAAA\t2001:db8::2"},
+		},
+		{
+			name: "Referral below a delegation", qname: "host.child.example.com.", qtype: dns.TypeA,
+			authority: []string{"child.example.com.\t3600\tIN\tNS\tns.child.example.com."},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := serveZone(t, zone, tt.qname, tt.qtype)
+
+			if response.RCode() != tt.wantRCode {
+				t.Errorf("RCode() = %d, want %d", response.RCode(), tt.wantRCode)
+			}
+			if response.Flags.AA != tt.wantAA {
+				t.Errorf("AA = %v, want %v", response.Flags.AA, tt.wantAA)
+			}
+			if got := strings.Join(recordStrings(response.Answer), "\n"); got != strings.Join(tt.answer, "\n") {
+				t.Errorf("Answer =\n%s\nwant\n%s", got, strings.Join(tt.answer, "\n"))
+			}
+			if got := strings.Join(recordStrings(response.Authority), "\n"); got != strings.Join(tt.authority, "\n") {
+				t.Errorf("Authority =\n%s\nwant\n%s", got, strings.Join(tt.authority, "\n"))
+			}
+		})
+	}
+}
+
+func TestZoneReferralGlue(t *testing.T) {
+	response := serveZone(t, newExampleZone(t), "child.example.com.", dns.TypeNS)
+
+	want := []string{"ns.child.example.com.\t3600\tIN\tA\t192.0.2.5"}
+	if got := recordStrings(response.Additional); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Additional = %v, want %v", got, want)
+	}
+}
+
+func TestZoneRefusesOtherZones(t *testing.T) {
+	mux := dns.NewServeMux()
+	mux.Handle("example.com.", newExampleZone(t))
+
+	for _, name := range []string{"example.org.", "com.", "notexample.com."} {
+		response := serveZone(t, mux, name, dns.TypeA)
+		if response.RCode() != dns.RCodeRefused {
+			t.Errorf("%s: RCode() = %d, want REFUSED", name, response.RCode())
+		}
+		if response.Flags.AA {
+			t.Errorf("%s: AA set on a refusal", name)
+		}
+	}
+
+	// The zone refuses on its own too, when reached without a mux
+	if response := serveZone(t, newExampleZone(t), "example.org.", dns.TypeA); response.RCode() != dns.RCodeRefused {
+		t.Errorf("Zone.ServeDNS() RCode() = %d, want REFUSED", response.RCode())
+	}
+}
+
+func TestZoneRefusesOtherClasses(t *testing.T) {
+	zone := newExampleZone(t)
+
+	request := query(t, "www.example.com.")
+	request.Question[0].QClass = dns.ClassCH
+	writer := &recordingWriter{}
+	zone.ServeDNS(writer, request)
+
+	response := writer.response
+	if response == nil {
+		t.Fatal("ServeDNS() wrote no response")
+	}
+	if response.RCode() != dns.RCodeRefused {
+		t.Errorf("RCode() = %d, want REFUSED", response.RCode())
+	}
+	if response.Flags.AA || len(response.Answer) != 0 {
+		t.Errorf("AA = %v with %d answers, want a plain refusal", response.Flags.AA, len(response.Answer))
+	}
+
+	// QCLASS ANY still matches the zone's own class
+	request.Question[0].QClass = dns.ClassANY
+	writer = &recordingWriter{}
+	zone.ServeDNS(writer, request)
+	if len(writer.response.Answer) != 1 {
+		t.Errorf("len(Answer) = %d for QCLASS ANY, want 1", len(writer.response.Answer))
+	}
+}
+
+func TestNewZoneErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		zone string
+	}{
+		{name: "No SOA", zone: "$TTL 60\nwww A 192.0.2.1\n"},
+		{name: "Two SOAs", zone: "$TTL 60\n@ SOA ns host 1 2 3 4 5\n@ SOA ns host 2 2 3 4 5\n"},
+		{name: "SOA below the apex", zone: "$TTL 60\n@ SOA ns host 1 2 3 4 5\nsub SOA ns host 1 2 3 4 5\n"},
+		{name: "Mixed classes", zone: "$TTL 60\n@ IN SOA ns host 1 2 3 4 5\nwww CH A 192.0.2.1\n"},
+		{name: "Record outside the zone", zone: "$TTL 60\n@ SOA ns host 1 2 3 4 5\nexample.org. A 192.0.2.1\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := dns.ParseZone(strings.NewReader(tt.zone), "example.com.")
+			if err != nil {
+				t.Fatalf("ParseZone() error = %v", err)
+			}
+			if _, err := dns.NewZone("example.com.", records); err == nil {
+				t.Error("NewZone() error = nil, want an error")
+			}
+		})
+	}
+}
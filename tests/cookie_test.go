@@ -0,0 +1,64 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+
+	dns "github.com/joegrn/dns/pkg"
+)
+
+func testCookieGenerator(now time.Time) *dns.CookieGenerator {
+	generator := &dns.CookieGenerator{Now: func() time.Time { return now }}
+	secret, _ := hex.DecodeString("e5e973e5a6b2a43f48e7dc849e37bfcf")
+	copy(generator.Secret[:], secret)
+	return generator
+}
+
+func TestCookieGeneratorGenerate(t *testing.T) {
+	// Test vector from RFC 9018 appendix A.1
+	generator := testCookieGenerator(time.Unix(1559731985, 0))
+	client, _ := hex.DecodeString("2464c4abcf10c957")
+
+	got := generator.Generate(client, net.ParseIP("198.51.100.100"))
+	want, _ := hex.DecodeString("010000005cf79f111f8130c3eee29480")
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("Generate() = %x, want %x", got, want)
+	}
+}
+
+func TestCookieGeneratorValidate(t *testing.T) {
+	issued := time.Unix(1559731985, 0)
+	client, _ := hex.DecodeString("2464c4abcf10c957")
+	ip := net.ParseIP("198.51.100.100")
+	server := testCookieGenerator(issued).Generate(client, ip)
+
+	tests := []struct {
+		name        string
+		now         time.Time
+		client      []byte
+		ip          net.IP
+		server      []byte
+		wantValid   bool
+		wantRefresh bool
+	}{
+		{"Fresh cookie", issued.Add(time.Minute), client, ip, server, true, false},
+		{"Cookie due for refresh", issued.Add(45 * time.Minute), client, ip, server, true, true},
+		{"Expired cookie", issued.Add(2 * time.Hour), client, ip, server, false, true},
+		{"Different client address", issued, client, net.ParseIP("198.51.100.101"), server, false, true},
+		{"Different client cookie", issued, []byte{1, 2, 3, 4, 5, 6, 7, 8}, ip, server, false, true},
+		{"Wrong length", issued, client, ip, server[:8], false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			valid, refresh := testCookieGenerator(tt.now).Validate(tt.client, tt.server, tt.ip)
+			if valid != tt.wantValid || refresh != tt.wantRefresh {
+				t.Errorf("Validate() = %v, %v, want %v, %v", valid, refresh, tt.wantValid, tt.wantRefresh)
+			}
+		})
+	}
+}
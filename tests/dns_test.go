@@ -8,6 +8,24 @@ import (
 	dns "github.com/joegrn/dns/pkg"
 )
 
+var localAddr = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 2053}
+
+// staticHandler answers every query with an A record for 8.8.8.8
+var staticHandler = dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+	var response dns.Message
+	response.SetReply(r, false, false)
+	response.Answer = []dns.DNSAnswer{
+		{
+			Name:  r.Question[0].QName,
+			Type:  dns.TypeA,
+			Class: dns.ClassIN,
+			TTL:   60,
+			Data:  &dns.ARecord{IP: net.IPv4(8, 8, 8, 8)},
+		},
+	}
+	w.WriteMsg(&response)
+})
+
 func TestHandleDnsRequest(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -31,7 +49,7 @@ func TestHandleDnsRequest(t *testing.T) {
 			want: append(
 				[]byte{
 					0x12, 0x34, // ID: 0x1234 (preserved from request)
-					0x01, 0x00, // Flags: copied from request
+					0x81, 0x00, // Flags: QR set, RD copied from request
 					0x00, 0x01, // QDCOUNT: 1
 					0x00, 0x01, // ANCOUNT: 1
 					0x00, 0x00, // NSCOUNT: 0
@@ -42,7 +60,7 @@ func TestHandleDnsRequest(t *testing.T) {
 				},
 				// Answer section
 				[]byte{
-					3, 'w', 'w', 'w', 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0,
+					0xC0, 0x0C, // pointer to the question name at offset 12
 					0x00, 0x01, // TYPE = A
 					0x00, 0x01, // CLASS = IN
 					0x00, 0x00, 0x00, 0x3c, // TTL = 60
@@ -55,17 +73,9 @@ func TestHandleDnsRequest(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Create a real UDP connection for the test
-			// since our function requires *net.UDPConn specifically
-			conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
-			if err != nil {
-				t.Fatalf("Failed to create UDP conn: %v", err)
-			}
-			defer conn.Close()
-
 			sourceAddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53000}
 
-			got := dns.HandleDnsRequest(conn, sourceAddr, tt.request)
+			got := dns.HandleDnsRequest(staticHandler, localAddr, sourceAddr, tt.request)
 
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("HandleDnsRequest() returned incorrect response")
@@ -85,3 +95,130 @@ func TestHandleDnsRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleDnsRequestErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		request   []byte
+		wantDrop  bool
+		wantRCode uint8
+	}{
+		{
+			name:     "Shorter than a header",
+			request:  []byte{0x12, 0x34, 0x01, 0x00, 0x00, 0x01},
+			wantDrop: true,
+		},
+		{
+			name: "Response instead of query",
+			request: []byte{
+				0x12, 0x34, 0x81, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+			},
+			wantDrop: true,
+		},
+		{
+			name: "Truncated question",
+			request: []byte{
+				0x12, 0x34, // ID: 0x1234
+				0x01, 0x00, // Flags: standard query
+				0x00, 0x01, // QDCOUNT: 1
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				3, 'w', 'w', // label cut short
+			},
+			wantRCode: 1, // FORMERR
+		},
+		{
+			name: "No question",
+			request: []byte{
+				0x12, 0x34, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+			},
+			wantRCode: 1, // FORMERR
+		},
+		{
+			name: "Unsupported opcode",
+			request: []byte{
+				0x12, 0x34, // ID: 0x1234
+				0x28, 0x00, // Flags: opcode 5 (UPDATE)
+				0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0,
+				0x00, 0x06, // QTYPE = SOA
+				0x00, 0x01, // QCLASS = IN
+			},
+			wantRCode: 4, // NOTIMP
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := dns.HandleDnsRequest(staticHandler, localAddr, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53000}, tt.request)
+
+			if tt.wantDrop {
+				if got != nil {
+					t.Errorf("HandleDnsRequest() = %v, want the packet dropped", got)
+				}
+				return
+			}
+
+			if len(got) < 12 {
+				t.Fatalf("HandleDnsRequest() returned %d bytes, want a full header", len(got))
+			}
+
+			if got[0] != 0x12 || got[1] != 0x34 {
+				t.Errorf("response ID = 0x%02x%02x, want 0x1234", got[0], got[1])
+			}
+
+			flags := dns.UnmarshalFlags(got[2:4])
+			if !flags.QR {
+				t.Errorf("response QR bit not set")
+			}
+			if flags.RCODE != tt.wantRCode {
+				t.Errorf("response RCODE = %d, want %d", flags.RCODE, tt.wantRCode)
+			}
+			if flags.OpCode != dns.UnmarshalFlags(tt.request[2:4]).OpCode {
+				t.Errorf("response OPCODE = %d, want it echoed", flags.OpCode)
+			}
+		})
+	}
+}
+
+func TestHandleDnsRequestHandlerOutcomes(t *testing.T) {
+	request := []byte{
+		0x12, 0x34, 0x01, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0,
+		0x00, 0x01, 0x00, 0x01,
+	}
+
+	t.Run("Handler that writes nothing", func(t *testing.T) {
+		silent := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {})
+		if got := dns.HandleDnsRequest(silent, localAddr, localAddr, request); got != nil {
+			t.Errorf("HandleDnsRequest() = %v, want no reply", got)
+		}
+	})
+
+	t.Run("Response that cannot be packed", func(t *testing.T) {
+		broken := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+			var response dns.Message
+			response.SetReply(r, false, false)
+			response.Answer = []dns.DNSAnswer{{Name: r.Question[0].QName, Type: dns.TypeA, Class: dns.ClassIN, Data: &dns.ARecord{}}}
+			w.WriteMsg(&response)
+		})
+
+		got := dns.HandleDnsRequest(broken, localAddr, localAddr, request)
+		if len(got) < 12 {
+			t.Fatalf("HandleDnsRequest() returned %d bytes, want a full header", len(got))
+		}
+		if rcode := dns.UnmarshalFlags(got[2:4]).RCODE; rcode != 2 {
+			t.Errorf("response RCODE = %d, want 2 (SERVFAIL)", rcode)
+		}
+	})
+
+	t.Run("Response ID is forced to the query ID", func(t *testing.T) {
+		wrongID := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+			w.WriteMsg(&dns.Message{ID: 0xFFFF, Question: r.Question})
+		})
+
+		got := dns.HandleDnsRequest(wrongID, localAddr, localAddr, request)
+		if got[0] != 0x12 || got[1] != 0x34 {
+			t.Errorf("response ID = 0x%02x%02x, want 0x1234", got[0], got[1])
+		}
+	})
+}
@@ -0,0 +1,205 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	dns "github.com/joegrn/dns/pkg"
+)
+
+// dohHandler answers with two A records of different TTLs, or NXDOMAIN with
+// an SOA for names under missing.example.com.
+var dohHandler = dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+	var response dns.Message
+	response.SetReply(r, true, false)
+
+	if dns.NameToString(r.Question[0].QName) == "missing.example.com." {
+		response.SetRCode(dns.RCodeNXDomain)
+		response.Authority = []dns.DNSAnswer{{
+			Name:  []byte{7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0},
+			Type:  dns.TypeSOA,
+			Class: dns.ClassIN,
+			TTL:   3600,
+			Data: &dns.SOARecord{
+				MName:   []byte{2, 'n', 's', 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0},
+				RName:   []byte{4, 'h', 'o', 's', 't', 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0},
+				Serial:  1,
+				Minimum: 120,
+			},
+		}}
+		w.WriteMsg(&response)
+		return
+	}
+
+	for _, ttl := range []uint32{300, 60} {
+		response.Answer = append(response.Answer, dns.DNSAnswer{
+			Name:  r.Question[0].QName,
+			Type:  dns.TypeA,
+			Class: dns.ClassIN,
+			TTL:   ttl,
+			Data:  &dns.ARecord{IP: net.IPv4(192, 0, 2, byte(ttl))},
+		})
+	}
+	w.WriteMsg(&response)
+})
+
+func startDoHServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(&dns.DoHHandler{Server: &dns.Server{Handler: dohHandler}, JSON: true})
+	t.Cleanup(server.Close)
+	return server
+}
+
+func readDoHResponse(t *testing.T, response *http.Response) *dns.Message {
+	t.Helper()
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", response.StatusCode)
+	}
+	if contentType := response.Header.Get("Content-Type"); contentType != dns.DoHMediaType {
+		t.Errorf("Content-Type = %q, want %q", contentType, dns.DoHMediaType)
+	}
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	var message dns.Message
+	if err := message.Unpack(body); err != nil {
+		t.Fatalf("Unpack() error = %v", err)
+	}
+	return &message
+}
+
+func TestDoHHandlerGetAndPost(t *testing.T) {
+	server := startDoHServer(t)
+
+	request := query(t, "www.example.com")
+	request.ID = 0
+	packed, err := request.Pack()
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+
+	get, err := http.Get(server.URL + "/dns-query?dns=" + base64.RawURLEncoding.EncodeToString(packed))
+	if err != nil {
+		t.Fatalf("GET error = %v", err)
+	}
+	post, err := http.Post(server.URL+"/dns-query", dns.DoHMediaType, bytes.NewReader(packed))
+	if err != nil {
+		t.Fatalf("POST error = %v", err)
+	}
+
+	for method, response := range map[string]*http.Response{"GET": get, "POST": post} {
+		if cacheControl := response.Header.Get("Cache-Control"); cacheControl != "max-age=60" {
+			t.Errorf("%s Cache-Control = %q, want the smallest TTL", method, cacheControl)
+		}
+		if message := readDoHResponse(t, response); len(message.Answer) != 2 {
+			t.Errorf("%s len(Answer) = %d, want 2", method, len(message.Answer))
+		}
+	}
+}
+
+func TestDoHHandlerNegativeCaching(t *testing.T) {
+	server := startDoHServer(t)
+
+	packed, err := query(t, "missing.example.com").Pack()
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+	response, err := http.Get(server.URL + "/dns-query?dns=" + base64.RawURLEncoding.EncodeToString(packed))
+	if err != nil {
+		t.Fatalf("GET error = %v", err)
+	}
+
+	if cacheControl := response.Header.Get("Cache-Control"); cacheControl != "max-age=120" {
+		t.Errorf("Cache-Control = %q, want the SOA minimum", cacheControl)
+	}
+	if message := readDoHResponse(t, response); message.RCode() != dns.RCodeNXDomain {
+		t.Errorf("RCode() = %d, want NXDOMAIN", message.RCode())
+	}
+}
+
+func TestDoHHandlerErrors(t *testing.T) {
+	server := startDoHServer(t)
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        []byte
+		want        int
+	}{
+		{name: "Missing parameter", method: http.MethodGet, path: "/dns-query", want: http.StatusBadRequest},
+		{name: "Invalid base64", method: http.MethodGet, path: "/dns-query?dns=!!!", want: http.StatusBadRequest},
+		{name: "Short query", method: http.MethodGet, path: "/dns-query?dns=AAAA", want: http.StatusBadRequest},
+		{name: "Wrong content type", method: http.MethodPost, path: "/dns-query", contentType: "text/plain", body: []byte("hello"), want: http.StatusUnsupportedMediaType},
+		{name: "Unsupported method", method: http.MethodPut, path: "/dns-query", want: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, err := http.NewRequest(tt.method, server.URL+tt.path, bytes.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("NewRequest() error = %v", err)
+			}
+			if tt.contentType != "" {
+				request.Header.Set("Content-Type", tt.contentType)
+			}
+			response, err := http.DefaultClient.Do(request)
+			if err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+			response.Body.Close()
+			if response.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", response.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestDoHHandlerJSON(t *testing.T) {
+	server := startDoHServer(t)
+
+	response, err := http.Get(server.URL + "/resolve?name=www.example.com&type=A")
+	if err != nil {
+		t.Fatalf("GET error = %v", err)
+	}
+	defer response.Body.Close()
+
+	if contentType := response.Header.Get("Content-Type"); contentType != dns.JSONMediaType {
+		t.Errorf("Content-Type = %q, want %q", contentType, dns.JSONMediaType)
+	}
+
+	var result struct {
+		Status   int
+		RD       bool
+		Question []struct {
+			Name string `json:"name"`
+			Type int    `json:"type"`
+		}
+		Answer []struct {
+			Name string `json:"name"`
+			Type int    `json:"type"`
+			TTL  int
+			Data string `json:"data"`
+		}
+	}
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	if result.Status != 0 || !result.RD || len(result.Question) != 1 || result.Question[0].Name != "www.example.com." {
+		t.Errorf("result = %+v, want NOERROR for www.example.com.", result)
+	}
+	if len(result.Answer) != 2 || result.Answer[1].Data != "192.0.2.60" || result.Answer[1].TTL != 60 {
+		t.Errorf("Answer = %+v, want two A records", result.Answer)
+	}
+}
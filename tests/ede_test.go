@@ -0,0 +1,83 @@
+package tests
+
+import (
+	"testing"
+
+	dns "github.com/joegrn/dns/pkg"
+)
+
+func TestExtendedErrorRoundTrip(t *testing.T) {
+	message := dns.Message{ID: 1, Flags: dns.Flags{QR: true}, EDNS: &dns.EDNS{UDPSize: 1232}}
+	message.SetRCode(dns.RCodeRefused)
+	message.SetExtendedError(dns.EDEBlocked, "listed in policy")
+
+	packed, err := message.Pack()
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+
+	var got dns.Message
+	if err := got.Unpack(packed); err != nil {
+		t.Fatalf("Unpack() error = %v", err)
+	}
+
+	errors := got.ExtendedErrors()
+	if len(errors) != 1 {
+		t.Fatalf("ExtendedErrors() returned %d errors, want 1", len(errors))
+	}
+	if errors[0].InfoCode != dns.EDEBlocked || errors[0].ExtraText != "listed in policy" {
+		t.Errorf("ExtendedErrors() = %+v", errors[0])
+	}
+	if errors[0].String() != "EDE 15 (Blocked): listed in policy" {
+		t.Errorf("String() = %q", errors[0].String())
+	}
+}
+
+func TestExtendedErrorUnpack(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		wantCode uint16
+		wantText string
+		wantErr  bool
+	}{
+		{"Code only", []byte{0x00, 0x03}, dns.EDEStaleAnswer, "", false},
+		{"With text", []byte{0x00, 0x06, 'b', 'a', 'd'}, dns.EDEDNSSECBogus, "bad", false},
+		{"NUL terminated text", []byte{0x00, 0x12, 'n', 'o', 0}, dns.EDEProhibited, "no", false},
+		{"Too short", []byte{0x00}, 0, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var option dns.ExtendedErrorOption
+			err := option.Unpack(tt.data)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Unpack() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr && (option.InfoCode != tt.wantCode || option.ExtraText != tt.wantText) {
+				t.Errorf("Unpack() = %d %q, want %d %q", option.InfoCode, option.ExtraText, tt.wantCode, tt.wantText)
+			}
+		})
+	}
+}
+
+func TestSetExtendedErrorWithoutEDNS(t *testing.T) {
+	message := dns.Message{}
+	message.SetExtendedError(dns.EDEBlocked, "")
+
+	if message.EDNS != nil || message.ExtendedErrors() != nil {
+		t.Errorf("SetExtendedError() must not add EDNS to a message without it")
+	}
+}
+
+func TestHandleDnsRequestBadVersExtendedError(t *testing.T) {
+	response := exchange(t, ednsQuery(4096, 1, false))
+
+	errors := response.ExtendedErrors()
+	if len(errors) != 1 || errors[0].InfoCode != dns.EDEOther {
+		t.Errorf("BADVERS response extended errors = %v", errors)
+	}
+}
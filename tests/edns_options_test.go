@@ -0,0 +1,145 @@
+package tests
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	dns "github.com/joegrn/dns/pkg"
+)
+
+type testOption struct {
+	Value byte
+}
+
+func (o *testOption) Code() uint16 { return 65001 }
+
+func (o *testOption) Pack() ([]byte, error) { return []byte{o.Value}, nil }
+
+func (o *testOption) Unpack(data []byte) error {
+	o.Value = data[0]
+	return nil
+}
+
+func packWithOptions(t *testing.T, options ...dns.EDNSOption) []byte {
+	t.Helper()
+	message := dns.Message{
+		ID:       0x1234,
+		Flags:    dns.Flags{RD: true},
+		Question: []dns.DNSQuestion{{QName: []byte{7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0}, QType: dns.TypeA, QClass: dns.ClassIN}},
+		EDNS:     &dns.EDNS{UDPSize: 4096, Options: options},
+	}
+	packed, err := message.Pack()
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+	return packed
+}
+
+func TestEDNSOptionRoundTrip(t *testing.T) {
+	dns.RegisterEDNSOption(65001, func() dns.EDNSOption { return new(testOption) })
+
+	options := []dns.EDNSOption{
+		&dns.NSIDOption{NSID: []byte("ns1")},
+		&dns.CookieOption{Client: []byte{1, 2, 3, 4, 5, 6, 7, 8}, Server: bytes.Repeat([]byte{9}, 16)},
+		&dns.KeepaliveOption{Timeout: 30 * time.Second, HasTimeout: true},
+		&dns.PaddingOption{Length: 12},
+		&dns.UnknownOption{OptionCode: 65000, Data: []byte{0xaa}},
+		&testOption{Value: 7},
+	}
+
+	var message dns.Message
+	if err := message.Unpack(packWithOptions(t, options...)); err != nil {
+		t.Fatalf("Unpack() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(message.EDNS.Options, options) {
+		t.Errorf("Unpack() options = %#v, want %#v", message.EDNS.Options, options)
+	}
+}
+
+func TestCookieOptionMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"Short client cookie", []byte{1, 2, 3}},
+		{"Short server cookie", []byte{1, 2, 3, 4, 5, 6, 7, 8, 1, 2, 3}},
+		{"Long server cookie", bytes.Repeat([]byte{1}, 41)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var message dns.Message
+			err := message.Unpack(packWithOptions(t, &dns.UnknownOption{OptionCode: dns.OptionCodeCookie, Data: tt.data}))
+			if err == nil {
+				t.Errorf("Unpack() expected an error for a malformed cookie")
+			}
+		})
+	}
+}
+
+func exchange(t *testing.T, request []byte) dns.Message {
+	t.Helper()
+	raw := dns.HandleDnsRequest(staticHandler, localAddr, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53000}, request)
+
+	var response dns.Message
+	if err := response.Unpack(raw); err != nil {
+		t.Fatalf("Unpack() error = %v", err)
+	}
+	return response
+}
+
+func TestHandleDnsRequestCookies(t *testing.T) {
+	client := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+	first := exchange(t, packWithOptions(t, &dns.CookieOption{Client: client}))
+	cookie, ok := first.EDNS.Option(dns.OptionCodeCookie).(*dns.CookieOption)
+	if !ok {
+		t.Fatalf("response has no cookie option")
+	}
+	if !bytes.Equal(cookie.Client, client) || len(cookie.Server) != 16 {
+		t.Fatalf("response cookie = %x/%x, want client %x and a 16 octet server cookie", cookie.Client, cookie.Server, client)
+	}
+
+	second := exchange(t, packWithOptions(t, &dns.CookieOption{Client: client, Server: cookie.Server}))
+	if second.RCode() != dns.RCodeNoError || len(second.Answer) != 1 {
+		t.Errorf("valid cookie got RCODE %d with %d answers", second.RCode(), len(second.Answer))
+	}
+
+	forged := exchange(t, packWithOptions(t, &dns.CookieOption{Client: client, Server: bytes.Repeat([]byte{0xff}, 16)}))
+	if forged.RCode() != dns.RCodeBadCookie {
+		t.Errorf("forged cookie got RCODE %d, want %d", forged.RCode(), dns.RCodeBadCookie)
+	}
+	if fresh, ok := forged.EDNS.Option(dns.OptionCodeCookie).(*dns.CookieOption); !ok || len(fresh.Server) != 16 {
+		t.Errorf("BADCOOKIE response must carry a fresh server cookie")
+	}
+}
+
+func TestHandleDnsRequestNSIDAndPadding(t *testing.T) {
+	dns.DefaultEDNSConfig.NSID = []byte("instance-a")
+	defer func() { dns.DefaultEDNSConfig.NSID = nil }()
+
+	request := packWithOptions(t, &dns.NSIDOption{}, &dns.PaddingOption{Length: 8}, &dns.KeepaliveOption{})
+
+	raw := dns.HandleDnsRequest(staticHandler, localAddr, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53000}, request)
+	if len(raw)%dns.DefaultEDNSConfig.PaddingBlockSize != 0 {
+		t.Errorf("padded response is %d octets, want a multiple of %d", len(raw), dns.DefaultEDNSConfig.PaddingBlockSize)
+	}
+
+	var response dns.Message
+	if err := response.Unpack(raw); err != nil {
+		t.Fatalf("Unpack() error = %v", err)
+	}
+
+	nsid, ok := response.EDNS.Option(dns.OptionCodeNSID).(*dns.NSIDOption)
+	if !ok || string(nsid.NSID) != "instance-a" {
+		t.Errorf("response NSID = %v, want instance-a", response.EDNS.Option(dns.OptionCodeNSID))
+	}
+
+	if response.EDNS.Option(dns.OptionCodeKeepalive) != nil {
+		t.Errorf("keepalive must not be sent over UDP")
+	}
+}
@@ -0,0 +1,150 @@
+package tests
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	dns "github.com/joegrn/dns/pkg"
+)
+
+func ednsQuery(udpSize uint16, version uint8, do bool) []byte {
+	flags := byte(0x00)
+	if do {
+		flags = 0x80
+	}
+	return []byte{
+		0x12, 0x34, // ID: 0x1234
+		0x01, 0x00, // Flags: standard query
+		0x00, 0x01, // QDCOUNT: 1
+		0x00, 0x00, // ANCOUNT: 0
+		0x00, 0x00, // NSCOUNT: 0
+		0x00, 0x01, // ARCOUNT: 1
+		7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0,
+		0x00, 0x01, // QTYPE = A
+		0x00, 0x01, // QCLASS = IN
+		0,          // root
+		0x00, 0x29, // TYPE = OPT
+		byte(udpSize >> 8), byte(udpSize), // CLASS = UDP payload size
+		0x00, version, flags, 0x00, // TTL = extended RCODE, version, DO
+		0x00, 0x00, // RDLENGTH = 0
+	}
+}
+
+func TestMessageUnpackEDNS(t *testing.T) {
+	var message dns.Message
+	if err := message.Unpack(ednsQuery(4096, 0, true)); err != nil {
+		t.Fatalf("Unpack() error = %v", err)
+	}
+
+	want := &dns.EDNS{UDPSize: 4096, Version: 0, DO: true}
+	if !reflect.DeepEqual(message.EDNS, want) {
+		t.Errorf("Unpack() EDNS = %+v, want %+v", message.EDNS, want)
+	}
+
+	if len(message.Additional) != 0 {
+		t.Errorf("Unpack() left the OPT record in the additional section")
+	}
+}
+
+func TestMessageUnpackDuplicateOPT(t *testing.T) {
+	query := ednsQuery(4096, 0, false)
+	query[11] = 2
+	query = append(query, 0, 0x00, 0x29, 0x10, 0x00, 0, 0, 0, 0, 0, 0)
+
+	var message dns.Message
+	if err := message.Unpack(query); err == nil {
+		t.Errorf("Unpack() expected an error for two OPT records")
+	}
+}
+
+func TestMessagePackEDNS(t *testing.T) {
+	message := dns.Message{
+		ID:    1,
+		Flags: dns.Flags{QR: true},
+		EDNS:  &dns.EDNS{UDPSize: 1232, DO: true},
+	}
+	message.SetRCode(dns.RCodeBadVers)
+
+	packed, err := message.Pack()
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+
+	want := []byte{
+		0x00, 0x01, // ID
+		0x80, 0x00, // Flags: QR, RCODE low bits 0
+		0x00, 0x00, // QDCOUNT: 0
+		0x00, 0x00, // ANCOUNT: 0
+		0x00, 0x00, // NSCOUNT: 0
+		0x00, 0x01, // ARCOUNT: 1
+		0,          // root
+		0x00, 0x29, // TYPE = OPT
+		0x04, 0xd0, // CLASS = 1232
+		0x01, 0x00, 0x80, 0x00, // extended RCODE 1 (BADVERS), version 0, DO
+		0x00, 0x00, // RDLENGTH = 0
+	}
+	if !reflect.DeepEqual(packed, want) {
+		t.Errorf("Pack() = %v, want %v", packed, want)
+	}
+
+	var roundTrip dns.Message
+	if err := roundTrip.Unpack(packed); err != nil {
+		t.Fatalf("Unpack() error = %v", err)
+	}
+	if roundTrip.RCode() != dns.RCodeBadVers {
+		t.Errorf("RCode() = %d, want %d", roundTrip.RCode(), dns.RCodeBadVers)
+	}
+}
+
+func TestHandleDnsRequestEDNS(t *testing.T) {
+	tests := []struct {
+		name      string
+		request   []byte
+		wantRCode uint16
+		wantSize  uint16
+		answers   int
+	}{
+		{
+			name:      "Supported version",
+			request:   ednsQuery(4096, 0, false),
+			wantRCode: dns.RCodeNoError,
+			wantSize:  dns.DefaultUDPSize,
+			answers:   1,
+		},
+		{
+			name:      "Unsupported version",
+			request:   ednsQuery(4096, 1, false),
+			wantRCode: dns.RCodeBadVers,
+			wantSize:  dns.DefaultUDPSize,
+			answers:   0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := dns.HandleDnsRequest(staticHandler, localAddr, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53000}, tt.request)
+
+			var response dns.Message
+			if err := response.Unpack(got); err != nil {
+				t.Fatalf("Unpack() error = %v", err)
+			}
+
+			if response.EDNS == nil {
+				t.Fatalf("response has no OPT record")
+			}
+			if response.EDNS.Version != 0 {
+				t.Errorf("response EDNS version = %d, want 0", response.EDNS.Version)
+			}
+			if response.EDNS.UDPSize != tt.wantSize {
+				t.Errorf("response UDP size = %d, want %d", response.EDNS.UDPSize, tt.wantSize)
+			}
+			if response.RCode() != tt.wantRCode {
+				t.Errorf("response RCODE = %d, want %d", response.RCode(), tt.wantRCode)
+			}
+			if len(response.Answer) != tt.answers {
+				t.Errorf("response has %d answers, want %d", len(response.Answer), tt.answers)
+			}
+		})
+	}
+}
@@ -94,7 +94,23 @@ func TestUnmarshalFlags(t *testing.T) {
 				RD:     false,
 				RA:     false,
 				Z:      0,
-				RCODE:  4, // Per your implementation, non-0 opcode gets RCODE 4
+				RCODE:  0, // Parsing leaves RCODE as sent, NOTIMP is decided by the server
+			},
+		},
+		{
+			name:  "AD and CD bits",
+			input: []byte{0x01, 0x30}, // RD, AD and CD set
+			want: dns.Flags{
+				QR:     false,
+				OpCode: 0,
+				AA:     false,
+				TC:     false,
+				RD:     true,
+				RA:     false,
+				Z:      0,
+				AD:     true,
+				CD:     true,
+				RCODE:  0,
 			},
 		},
 	}
@@ -172,7 +188,7 @@ func TestMarshalFlags(t *testing.T) {
 			want: 0x8183, // QR, RD, RA bits set and RCODE=3
 		},
 		{
-			name: "With Z bits set",
+			name: "With Z bit set",
 			flags: dns.Flags{
 				QR:     false,
 				OpCode: 0,
@@ -180,10 +196,18 @@ func TestMarshalFlags(t *testing.T) {
 				TC:     false,
 				RD:     false,
 				RA:     false,
-				Z:      3,
+				Z:      1,
 				RCODE:  0,
 			},
-			want: 0x0030, // Z=3 (bits 4-6 set)
+			want: 0x0040, // Z=1 (bit 6 set)
+		},
+		{
+			name: "With AD and CD bits set",
+			flags: dns.Flags{
+				AD: true,
+				CD: true,
+			},
+			want: 0x0030, // bits 4 and 5 set
 		},
 	}
 
@@ -197,6 +221,53 @@ func TestMarshalFlags(t *testing.T) {
 	}
 }
 
+func TestResponseFlags(t *testing.T) {
+	tests := []struct {
+		name               string
+		query              dns.Flags
+		authoritative      bool
+		recursionAvailable bool
+		want               uint16
+	}{
+		{
+			name:  "Recursive query to non-recursive server",
+			query: dns.Flags{RD: true},
+			want:  0x8100, // QR, RD
+		},
+		{
+			name:          "Authoritative answer",
+			query:         dns.Flags{},
+			authoritative: true,
+			want:          0x8400, // QR, AA
+		},
+		{
+			name:               "Recursion available",
+			query:              dns.Flags{RD: true},
+			recursionAvailable: true,
+			want:               0x8180, // QR, RD, RA
+		},
+		{
+			name:  "Query bits that must not be echoed",
+			query: dns.Flags{QR: true, AA: true, TC: true, RA: true, Z: 1, AD: true, RCODE: 3},
+			want:  0x8000, // QR only
+		},
+		{
+			name:  "Opcode and CD are copied",
+			query: dns.Flags{OpCode: 2, CD: true},
+			want:  0x9010, // QR, OPCODE=2, CD
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := dns.MarshalFlags(dns.ResponseFlags(tt.query, tt.authoritative, tt.recursionAvailable))
+			if got != tt.want {
+				t.Errorf("ResponseFlags() = 0x%04x, want 0x%04x", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestBitManipulation(t *testing.T) {
 	// For these tests, we need to directly access the bit manipulation functions,
 	// but since they're unexported, we'll test them indirectly through the Marshal/Unmarshal functions
@@ -0,0 +1,136 @@
+package tests
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	dns "github.com/joegrn/dns/pkg"
+)
+
+func TestMessageUnpack(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []byte
+		want    dns.Message
+		wantErr bool
+	}{
+		{
+			name: "Response with compressed answer",
+			input: []byte{
+				0x12, 0x34, // ID: 0x1234
+				0x81, 0x80, // Flags: standard response
+				0x00, 0x01, // QDCOUNT: 1
+				0x00, 0x01, // ANCOUNT: 1
+				0x00, 0x00, // NSCOUNT: 0
+				0x00, 0x00, // ARCOUNT: 0
+				7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0, // example.com
+				0x00, 0x01, // QTYPE = A
+				0x00, 0x01, // QCLASS = IN
+				0xC0, 0x0C, // pointer to example.com
+				0x00, 0x01, // TYPE = A
+				0x00, 0x01, // CLASS = IN
+				0x00, 0x00, 0x00, 0x3c, // TTL = 60
+				0x00, 0x04, // RDLENGTH = 4
+				192, 0, 2, 1, // RDATA
+			},
+			want: dns.Message{
+				ID:    0x1234,
+				Flags: dns.Flags{QR: true, RD: true, RA: true},
+				Question: []dns.DNSQuestion{
+					{QName: []byte{7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0}, QType: 1, QClass: 1},
+				},
+				Answer: []dns.DNSAnswer{
+					{
+						Name:     []byte{7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0},
+						Type:     1,
+						Class:    1,
+						TTL:      60,
+						RDLength: 4,
+						Data:     &dns.ARecord{IP: net.IP{192, 0, 2, 1}},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Counts larger than the message",
+			input: []byte{
+				0x12, 0x34,
+				0x01, 0x00,
+				0x00, 0x02, // QDCOUNT: 2, only one present
+				0x00, 0x00,
+				0x00, 0x00,
+				0x00, 0x00,
+				7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0,
+				0x00, 0x01,
+				0x00, 0x01,
+			},
+			wantErr: true,
+		},
+		{
+			name:    "Short header",
+			input:   []byte{0x12, 0x34, 0x01},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got dns.Message
+			err := got.Unpack(tt.input)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Unpack() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Unpack() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMessagePack(t *testing.T) {
+	name := []byte{7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0}
+
+	message := dns.Message{
+		ID:       0xABCD,
+		Flags:    dns.Flags{QR: true, AA: true},
+		Question: []dns.DNSQuestion{{QName: name, QType: 1, QClass: 1}},
+		Answer: []dns.DNSAnswer{
+			{Name: name, Type: 1, Class: 1, TTL: 300, RDLength: 4, Data: &dns.ARecord{IP: net.IP{192, 0, 2, 1}}},
+			{Name: name, Type: 1, Class: 1, TTL: 300, RDLength: 4, Data: &dns.ARecord{IP: net.IP{192, 0, 2, 2}}},
+		},
+		Authority: []dns.DNSAnswer{
+			{Name: name, Type: 2, Class: 1, TTL: 300, RDLength: 2, Data: &dns.NSRecord{Host: name}},
+		},
+	}
+
+	packed, err := message.Pack()
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+
+	wantHeader := []byte{
+		0xAB, 0xCD, // ID
+		0x84, 0x00, // Flags: QR, AA
+		0x00, 0x01, // QDCOUNT: 1
+		0x00, 0x02, // ANCOUNT: 2
+		0x00, 0x01, // NSCOUNT: 1
+		0x00, 0x00, // ARCOUNT: 0
+	}
+	if !reflect.DeepEqual(packed[:12], wantHeader) {
+		t.Errorf("Pack() header = %v, want %v", packed[:12], wantHeader)
+	}
+
+	var roundTrip dns.Message
+	if err := roundTrip.Unpack(packed); err != nil {
+		t.Fatalf("Unpack() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(roundTrip, message) {
+		t.Errorf("Unpack(Pack()) = %+v, want %+v", roundTrip, message)
+	}
+}
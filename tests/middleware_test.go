@@ -0,0 +1,141 @@
+package tests
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"strings"
+	"testing"
+
+	dns "github.com/joegrn/dns/pkg"
+)
+
+type remoteWriter struct {
+	recordingWriter
+	remote net.Addr
+}
+
+func (w *remoteWriter) RemoteAddr() net.Addr { return w.remote }
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	tag := func(name string) dns.Middleware {
+		return func(next dns.Handler) dns.Handler {
+			return dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+				order = append(order, name+" before")
+				next.ServeDNS(w, r)
+				order = append(order, name+" after")
+			})
+		}
+	}
+
+	handler := dns.Chain(staticHandler, tag("outer"), tag("inner"))
+	handler.ServeDNS(&recordingWriter{}, query(t, "example.com."))
+
+	want := "outer before,inner before,inner after,outer after"
+	if got := strings.Join(order, ","); got != want {
+		t.Errorf("Chain() order = %s, want %s", got, want)
+	}
+}
+
+func TestWithRecovery(t *testing.T) {
+	panicking := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+		panic("boom")
+	})
+
+	var logs bytes.Buffer
+	writer := &recordingWriter{}
+	dns.Chain(panicking, dns.WithRecovery(log.New(&logs, "", 0))).ServeDNS(writer, query(t, "example.com."))
+
+	if writer.response == nil {
+		t.Fatalf("WithRecovery() wrote no response")
+	}
+	if writer.response.RCode() != dns.RCodeServFail {
+		t.Errorf("RCode() = %d, want %d", writer.response.RCode(), dns.RCodeServFail)
+	}
+	if !strings.Contains(logs.String(), "boom") {
+		t.Errorf("WithRecovery() did not log the panic")
+	}
+}
+
+func TestWithLogging(t *testing.T) {
+	var logs bytes.Buffer
+	dns.Chain(staticHandler, dns.WithLogging(log.New(&logs, "", 0))).ServeDNS(&recordingWriter{}, query(t, "example.com."))
+
+	if got := logs.String(); !strings.Contains(got, "example.com. IN A") || !strings.Contains(got, "rcode=0 answers=1") {
+		t.Errorf("WithLogging() logged %q", got)
+	}
+}
+
+func TestWithMetrics(t *testing.T) {
+	metrics := dns.NewMetrics()
+	handler := dns.Chain(staticHandler, dns.WithMetrics(metrics))
+
+	handler.ServeDNS(&recordingWriter{}, query(t, "example.com."))
+	handler.ServeDNS(&recordingWriter{}, query(t, "www.example.com."))
+
+	snapshot := metrics.Snapshot()
+	if snapshot.Queries != 2 {
+		t.Errorf("Queries = %d, want 2", snapshot.Queries)
+	}
+	if snapshot.RCodes[dns.RCodeNoError] != 2 {
+		t.Errorf("RCodes[NOERROR] = %d, want 2", snapshot.RCodes[dns.RCodeNoError])
+	}
+	if snapshot.QTypes[dns.TypeA] != 2 {
+		t.Errorf("QTypes[A] = %d, want 2", snapshot.QTypes[dns.TypeA])
+	}
+}
+
+func TestWithACL(t *testing.T) {
+	acl, err := dns.NewACL([]string{"10.0.0.0/8", "192.0.2.1"}, []string{"10.1.0.0/16"})
+	if err != nil {
+		t.Fatalf("NewACL() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		ip      net.IP
+		allowed bool
+	}{
+		{"Allowed network", net.IPv4(10, 2, 3, 4), true},
+		{"Allowed host", net.IPv4(192, 0, 2, 1), true},
+		{"Denied inside allowed network", net.IPv4(10, 1, 2, 3), false},
+		{"Not listed", net.IPv4(198, 51, 100, 1), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writer := &remoteWriter{remote: &net.UDPAddr{IP: tt.ip, Port: 5300}}
+			dns.Chain(staticHandler, dns.WithACL(acl)).ServeDNS(writer, query(t, "example.com."))
+
+			if tt.allowed {
+				if writer.response.RCode() != dns.RCodeNoError {
+					t.Errorf("RCode() = %d, want NOERROR", writer.response.RCode())
+				}
+				return
+			}
+
+			if writer.response.RCode() != dns.RCodeRefused {
+				t.Errorf("RCode() = %d, want REFUSED", writer.response.RCode())
+			}
+			if errors := writer.response.ExtendedErrors(); len(errors) != 1 || errors[0].InfoCode != dns.EDEProhibited {
+				t.Errorf("ExtendedErrors() = %v, want Prohibited", errors)
+			}
+		})
+	}
+}
+
+func TestWithRewrite(t *testing.T) {
+	lowerTTL := dns.WithRewrite(func(r *dns.Message, response *dns.Message) {
+		for i := range response.Answer {
+			response.Answer[i].TTL = 5
+		}
+	})
+
+	writer := &recordingWriter{}
+	dns.Chain(staticHandler, lowerTTL).ServeDNS(writer, query(t, "example.com."))
+
+	if writer.response.Answer[0].TTL != 5 {
+		t.Errorf("TTL = %d, want 5", writer.response.Answer[0].TTL)
+	}
+}
@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"net"
+	"testing"
+
+	dns "github.com/joegrn/dns/pkg"
+)
+
+type recordingWriter struct {
+	response *dns.Message
+}
+
+func (w *recordingWriter) LocalAddr() net.Addr  { return localAddr }
+func (w *recordingWriter) RemoteAddr() net.Addr { return localAddr }
+
+func (w *recordingWriter) WriteMsg(m *dns.Message) error {
+	w.response = m
+	return nil
+}
+
+func namedHandler(name string, served *string) dns.Handler {
+	return dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+		*served = name
+	})
+}
+
+func query(t *testing.T, name string) *dns.Message {
+	t.Helper()
+	qname, err := dns.ParseName(name)
+	if err != nil {
+		t.Fatalf("ParseName() error = %v", err)
+	}
+	return &dns.Message{
+		ID:       1,
+		Question: []dns.DNSQuestion{{QName: qname, QType: dns.TypeA, QClass: dns.ClassIN}},
+		EDNS:     &dns.EDNS{UDPSize: 1232},
+	}
+}
+
+func TestServeMuxLongestMatch(t *testing.T) {
+	var served string
+	mux := dns.NewServeMux()
+	mux.Handle("example.com.", namedHandler("example.com", &served))
+	mux.Handle("internal.example.com.", namedHandler("internal.example.com", &served))
+	mux.Handle(".", namedHandler("root", &served))
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"example.com.", "example.com"},
+		{"www.example.com.", "example.com"},
+		{"db.internal.example.com.", "internal.example.com"},
+		{"INTERNAL.Example.COM.", "internal.example.com"},
+		{"notexample.com.", "root"},
+		{"example.org.", "root"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			served = ""
+			mux.ServeDNS(&recordingWriter{}, query(t, tt.name))
+			if served != tt.want {
+				t.Errorf("ServeDNS() used handler %q, want %q", served, tt.want)
+			}
+		})
+	}
+}
+
+func TestServeMuxNoMatch(t *testing.T) {
+	var served string
+	mux := dns.NewServeMux()
+	mux.Handle("example.com.", namedHandler("example.com", &served))
+
+	writer := &recordingWriter{}
+	mux.ServeDNS(writer, query(t, "example.org."))
+
+	if served != "" {
+		t.Fatalf("ServeDNS() used handler %q for a name outside every zone", served)
+	}
+	if writer.response == nil {
+		t.Fatalf("ServeDNS() wrote no response")
+	}
+	if writer.response.RCode() != dns.RCodeRefused {
+		t.Errorf("RCode() = %d, want %d", writer.response.RCode(), dns.RCodeRefused)
+	}
+	if errors := writer.response.ExtendedErrors(); len(errors) != 1 || errors[0].InfoCode != dns.EDENotAuthoritative {
+		t.Errorf("ExtendedErrors() = %v, want Not Authoritative", errors)
+	}
+}
+
+func TestServeMuxHandleRemove(t *testing.T) {
+	var served string
+	mux := dns.NewServeMux()
+	mux.Handle("example.com.", namedHandler("example.com", &served))
+	mux.HandleRemove("example.com.")
+
+	if mux.Handler([]byte{7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0}) != nil {
+		t.Errorf("Handler() found a removed zone")
+	}
+}
@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"reflect"
+	"testing"
+
+	dns "github.com/joegrn/dns/pkg"
+)
+
+func TestParseName(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []byte
+		wantErr bool
+	}{
+		{"Fully qualified", "www.example.com.", []byte{3, 'w', 'w', 'w', 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0}, false},
+		{"Without trailing dot", "example.com", []byte{7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0}, false},
+		{"Root", ".", []byte{0}, false},
+		{"Escaped dot", `a\.b.com.`, []byte{3, 'a', '.', 'b', 3, 'c', 'o', 'm', 0}, false},
+		{"Decimal escape", `a\032b.`, []byte{3, 'a', ' ', 'b', 0}, false},
+		{"Empty label", "a..com.", nil, true},
+		{"Empty", "", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := dns.ParseName(tt.input)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseName() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNameToString(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		want  string
+	}{
+		{"Simple", []byte{7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0}, "example.com."},
+		{"Root", []byte{0}, "."},
+		{"Dot inside label", []byte{3, 'a', '.', 'b', 0}, `a\.b.`},
+		{"Non-printable octet", []byte{1, 0x07, 0}, `\007.`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dns.NameToString(tt.input); got != tt.want {
+				t.Errorf("NameToString() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+//go:build linux
+
+package tests
+
+import (
+	"net"
+	"testing"
+
+	dns "github.com/joegrn/dns/pkg"
+)
+
+func TestServerWildcardRepliesFromQueriedAddress(t *testing.T) {
+	tests := []struct {
+		name   string
+		listen string
+		target net.IP
+	}{
+		{name: "IPv4 wildcard", listen: "0.0.0.0:0", target: net.IPv4(127, 0, 0, 2)},
+		{name: "Dual stack with IPv4 client", listen: "[::]:0", target: net.IPv4(127, 0, 0, 3)},
+		{name: "Dual stack with IPv6 client", listen: "[::]:0", target: net.IPv6loopback},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			locals := make(chan net.Addr, 1)
+			handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+				locals <- w.LocalAddr()
+				staticHandler.ServeDNS(w, r)
+			})
+			addr := startUDPServerOn(t, &dns.Server{Handler: handler}, tt.listen)
+
+			// exchangeUDP uses a connected socket, which discards replies from any
+			// address other than the one it sent to
+			target := &net.UDPAddr{IP: tt.target, Port: addr.(*net.UDPAddr).Port}
+			exchangeUDP(t, target, query(t, "example.com"))
+
+			local := (<-locals).(*net.UDPAddr)
+			if !local.IP.Equal(tt.target) {
+				t.Errorf("LocalAddr() = %v, want %v", local, tt.target)
+			}
+		})
+	}
+}
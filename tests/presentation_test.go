@@ -0,0 +1,132 @@
+package tests
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	dns "github.com/joegrn/dns/pkg"
+)
+
+func TestParseRR(t *testing.T) {
+	name := []byte{7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0}
+
+	tests := []struct {
+		name    string
+		input   string
+		want    dns.DNSAnswer
+		wantErr bool
+	}{
+		{
+			name:  "Known type",
+			input: "example.com. 300 IN A 192.0.2.1",
+			want:  dns.DNSAnswer{Name: name, Type: dns.TypeA, Class: dns.ClassIN, TTL: 300, Data: &dns.ARecord{IP: net.IP{192, 0, 2, 1}}},
+		},
+		{
+			name:  "Unknown type in generic form",
+			input: "example.com. 60 CLASS1 TYPE65280 \\# 4 0A000001",
+			want:  dns.DNSAnswer{Name: name, Type: 65280, Class: dns.ClassIN, TTL: 60, Data: &dns.UnknownRecord{RRType: 65280, Data: []byte{10, 0, 0, 1}}},
+		},
+		{
+			name:  "Known type in generic form",
+			input: "example.com. 60 IN A \\# 4 C0 00 02 01",
+			want:  dns.DNSAnswer{Name: name, Type: dns.TypeA, Class: dns.ClassIN, TTL: 60, Data: &dns.ARecord{IP: net.IP{192, 0, 2, 1}}},
+		},
+		{
+			name:  "Empty generic RDATA",
+			input: "example.com. 60 IN TYPE731 \\# 0",
+			want:  dns.DNSAnswer{Name: name, Type: 731, Class: dns.ClassIN, TTL: 60, Data: &dns.UnknownRecord{RRType: 731, Data: []byte{}}},
+		},
+		{
+			name:  "Quoted TXT strings",
+			input: `example.com. 60 IN TXT "hello world" "a \"quote\""`,
+			want:  dns.DNSAnswer{Name: name, Type: dns.TypeTXT, Class: dns.ClassIN, TTL: 60, Data: &dns.TXTRecord{Text: []string{"hello world", `a "quote"`}}},
+		},
+		{
+			name:    "Generic length mismatch",
+			input:   "example.com. 60 IN TYPE65280 \\# 3 0A000001",
+			wantErr: true,
+		},
+		{
+			name:    "Unknown type without generic form",
+			input:   "example.com. 60 IN TYPE65280 10.0.0.1",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := dns.ParseRR(tt.input)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseRR() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseRR() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDNSAnswerString(t *testing.T) {
+	name := []byte{7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0}
+
+	tests := []struct {
+		name   string
+		answer dns.DNSAnswer
+		want   string
+	}{
+		{
+			name:   "Known type",
+			answer: dns.DNSAnswer{Name: name, Type: dns.TypeA, Class: dns.ClassIN, TTL: 300, Data: &dns.ARecord{IP: net.IP{192, 0, 2, 1}}},
+			want:   "example.com.\t300\tIN\tA\t192.0.2.1",
+		},
+		{
+			name:   "Unknown type and class",
+			answer: dns.DNSAnswer{Name: name, Type: 65280, Class: 32, TTL: 60, Data: &dns.UnknownRecord{RRType: 65280, Data: []byte{0x0a, 0x00, 0x00, 0x01}}},
+			want:   "example.com.\t60\tCLASS32\tTYPE65280\t\\# 4 0A000001",
+		},
+		{
+			name:   "Raw RDATA without a typed value",
+			answer: dns.DNSAnswer{Name: name, Type: 99, Class: dns.ClassIN, TTL: 60, RData: []byte{0xff}},
+			want:   "example.com.\t60\tIN\tTYPE99\t\\# 1 FF",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.answer.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnknownTypeRoundTrip(t *testing.T) {
+	name := []byte{7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0}
+	rdata := []byte{0xC0, 0x0C, 0xde, 0xad} // must not be treated as a compression pointer
+
+	message := dns.Message{
+		Question: []dns.DNSQuestion{{QName: name, QType: 65280, QClass: dns.ClassIN}},
+		Answer: []dns.DNSAnswer{
+			{Name: name, Type: 65280, Class: dns.ClassIN, TTL: 60, Data: &dns.UnknownRecord{RRType: 65280, Data: rdata}},
+		},
+	}
+
+	packed, err := message.Pack()
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+
+	var got dns.Message
+	if err := got.Unpack(packed); err != nil {
+		t.Fatalf("Unpack() error = %v", err)
+	}
+
+	want := &dns.UnknownRecord{RRType: 65280, Data: rdata}
+	if !reflect.DeepEqual(got.Answer[0].Data, want) {
+		t.Errorf("Unpack() Data = %#v, want %#v", got.Answer[0].Data, want)
+	}
+}
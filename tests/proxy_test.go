@@ -0,0 +1,216 @@
+package tests
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	dns "github.com/joegrn/dns/pkg"
+)
+
+// proxyHeader builds a PROXY protocol v2 header for a client at source
+// talking to destination, with a TLV the server has to skip.
+func proxyHeader(source, destination *net.UDPAddr) []byte {
+	family, size := byte(0x12), net.IPv4len
+	if source.IP.To4() == nil {
+		family, size = 0x22, net.IPv6len
+	}
+
+	body := make([]byte, 0, 2*size+4)
+	if size == net.IPv4len {
+		body = append(append(body, source.IP.To4()...), destination.IP.To4()...)
+	} else {
+		body = append(append(body, source.IP.To16()...), destination.IP.To16()...)
+	}
+	body = binary.BigEndian.AppendUint16(body, uint16(source.Port))
+	body = binary.BigEndian.AppendUint16(body, uint16(destination.Port))
+	body = append(body, 0x04, 0x00, 0x01, 0xFF) // PP2_TYPE_NOOP
+
+	header := append([]byte("\r\n\r\n\x00\r\nQUIT\n"), 0x21, family)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(body)))
+	return append(header, body...)
+}
+
+// remoteRecorder answers like staticHandler and reports the client address
+// the handler was given.
+func remoteRecorder() (dns.Handler, chan net.Addr) {
+	remotes := make(chan net.Addr, 1)
+	return dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+		remotes <- w.RemoteAddr()
+		staticHandler.ServeDNS(w, r)
+	}), remotes
+}
+
+func mustParseNetworks(t *testing.T, entries ...string) []*net.IPNet {
+	t.Helper()
+	networks, err := dns.ParseNetworks(entries)
+	if err != nil {
+		t.Fatalf("ParseNetworks() error = %v", err)
+	}
+	return networks
+}
+
+var proxiedClient = &net.UDPAddr{IP: net.ParseIP("203.0.113.7"), Port: 40000}
+
+func TestServerProxyProtocolUDP(t *testing.T) {
+	tests := []struct {
+		name       string
+		trusted    []string
+		withHeader bool
+		wantClient bool
+	}{
+		{name: "Trusted balancer", trusted: []string{"127.0.0.0/8"}, withHeader: true, wantClient: true},
+		{name: "Trusted balancer without header", trusted: []string{"127.0.0.0/8"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, remotes := remoteRecorder()
+			addr := startUDPServer(t, &dns.Server{Handler: handler, ProxyTrusted: mustParseNetworks(t, tt.trusted...)})
+
+			request, err := query(t, "example.com").Pack()
+			if err != nil {
+				t.Fatalf("Pack() error = %v", err)
+			}
+			if tt.withHeader {
+				request = append(proxyHeader(proxiedClient, addr.(*net.UDPAddr)), request...)
+			}
+
+			conn, err := net.Dial("udp", addr.String())
+			if err != nil {
+				t.Fatalf("Dial() error = %v", err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(2 * time.Second))
+			conn.Write(request)
+
+			// The reply goes back to the balancer
+			if _, err := conn.Read(make([]byte, dns.MaxMessageSize)); err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+
+			remote, ok := (<-remotes).(*net.UDPAddr)
+			if !ok {
+				t.Fatalf("RemoteAddr() is not a *net.UDPAddr")
+			}
+			want := conn.LocalAddr().(*net.UDPAddr)
+			if tt.wantClient {
+				want = proxiedClient
+			}
+			if !remote.IP.Equal(want.IP) || remote.Port != want.Port {
+				t.Errorf("RemoteAddr() = %v, want %v", remote, want)
+			}
+		})
+	}
+}
+
+func TestServerProxyProtocolUDPUntrusted(t *testing.T) {
+	handler, remotes := remoteRecorder()
+	addr := startUDPServer(t, &dns.Server{Handler: handler, ProxyTrusted: mustParseNetworks(t, "192.0.2.0/24")})
+
+	request, err := query(t, "example.com").Pack()
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+	conn, err := net.Dial("udp", addr.String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	// A header from anyone else is not honoured, so the handler never runs
+	conn.Write(append(proxyHeader(proxiedClient, addr.(*net.UDPAddr)), request...))
+	conn.Read(make([]byte, dns.MaxMessageSize))
+	select {
+	case remote := <-remotes:
+		t.Errorf("handler ran for %v", remote)
+	default:
+	}
+}
+
+func TestServerProxyProtocolUDPMalformed(t *testing.T) {
+	server := &dns.Server{Handler: staticHandler, ProxyTrusted: mustParseNetworks(t, "127.0.0.0/8")}
+	addr := startUDPServer(t, server)
+
+	conn, err := net.Dial("udp", addr.String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+
+	// The header claims more address octets than the datagram holds
+	header := proxyHeader(proxiedClient, addr.(*net.UDPAddr))
+	conn.Write(header[:len(header)-4])
+
+	deadline := time.Now().Add(2 * time.Second)
+	for server.Malformed() < 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := server.Malformed(); got != 1 {
+		t.Errorf("Malformed() = %d, want 1", got)
+	}
+}
+
+func TestServerProxyProtocolTCP(t *testing.T) {
+	handler, remotes := remoteRecorder()
+	addr := startTCPServer(t, &dns.Server{Handler: handler, ProxyTrusted: mustParseNetworks(t, "127.0.0.1", "::1")})
+
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	client := &net.UDPAddr{IP: net.ParseIP("2001:db8::7"), Port: 40000}
+	conn.Write(proxyHeader(client, &net.UDPAddr{IP: net.IPv6loopback, Port: 53}))
+	for i := 0; i < 2; i++ {
+		writeTCPMessage(t, conn, query(t, "example.com"))
+		readTCPMessage(t, conn)
+
+		remote, ok := (<-remotes).(*net.TCPAddr)
+		if !ok || !remote.IP.Equal(client.IP) || remote.Port != client.Port {
+			t.Errorf("query %d: RemoteAddr() = %v, want %v", i, remote, client)
+		}
+	}
+}
+
+func TestServerProxyProtocolTLS(t *testing.T) {
+	dir := t.TempDir()
+	certificate := writeCertificate(t, dir, "proxied")
+	reloader, err := dns.NewCertificateReloader(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+	if err != nil {
+		t.Fatalf("NewCertificateReloader() error = %v", err)
+	}
+
+	handler, remotes := remoteRecorder()
+	server := &dns.Server{Handler: handler, ProxyTrusted: mustParseNetworks(t, "127.0.0.0/8")}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	go server.ServeTLS(listener, dns.NewTLSConfig(reloader))
+	defer server.Shutdown(context.Background())
+
+	raw, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	raw.SetDeadline(time.Now().Add(2 * time.Second))
+	raw.Write(proxyHeader(proxiedClient, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 853}))
+
+	conn := tls.Client(raw, trusting(certificate))
+	defer conn.Close()
+	writeTCPMessage(t, conn, query(t, "example.com"))
+	readTCPMessage(t, conn)
+
+	remote, ok := (<-remotes).(*net.TCPAddr)
+	if !ok || !remote.IP.Equal(proxiedClient.IP) {
+		t.Errorf("RemoteAddr() = %v, want %v", remote, proxiedClient)
+	}
+}
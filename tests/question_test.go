@@ -70,6 +70,101 @@ func TestReadDNSQuestion(t *testing.T) {
 	}
 }
 
+func TestReadDNSQuestionCompression(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []byte
+		offset  int64
+		want    []byte
+		wantErr bool
+	}{
+		{
+			name: "Pointer to earlier name",
+			input: []byte{
+				7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0, // example.com at offset 0
+				3, 'w', 'w', 'w', 0xC0, 0x00, // www + pointer to offset 0
+				0x00, 0x01, // QTYPE = A
+				0x00, 0x01, // QCLASS = IN
+			},
+			offset:  13,
+			want:    []byte{3, 'w', 'w', 'w', 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0},
+			wantErr: false,
+		},
+		{
+			name: "Chained pointers",
+			input: []byte{
+				3, 'c', 'o', 'm', 0, // com at offset 0
+				7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0xC0, 0x00, // example + pointer to com at offset 5
+				0xC0, 0x05, // pointer to example.com at offset 15
+				0x00, 0x01, // QTYPE = A
+				0x00, 0x01, // QCLASS = IN
+			},
+			offset:  15,
+			want:    []byte{7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0},
+			wantErr: false,
+		},
+		{
+			name: "Pointer loop",
+			input: []byte{
+				3, 'w', 'w', 'w', 0xC0, 0x00, // points back to itself
+				0x00, 0x01,
+				0x00, 0x01,
+			},
+			offset:  0,
+			wantErr: true,
+		},
+		{
+			name: "Pointer out of range",
+			input: []byte{
+				0xC0, 0xFF,
+				0x00, 0x01,
+				0x00, 0x01,
+			},
+			offset:  0,
+			wantErr: true,
+		},
+		{
+			name: "Truncated label",
+			input: []byte{
+				7, 'e', 'x', 'a',
+			},
+			offset:  0,
+			wantErr: true,
+		},
+		{
+			name:    "Name longer than 255 octets",
+			input:   append(bytes.Repeat(append([]byte{63}, bytes.Repeat([]byte{'a'}, 63)...), 4), 0, 0x00, 0x01, 0x00, 0x01),
+			offset:  0,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := bytes.NewReader(tt.input)
+			reader.Seek(tt.offset, 0)
+			got, err := dns.ReadDNSQuestion(reader)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ReadDNSQuestion() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if !reflect.DeepEqual(got.QName, tt.want) {
+				t.Errorf("ReadDNSQuestion().QName = %v, want %v", got.QName, tt.want)
+			}
+
+			if got.QType != 1 || got.QClass != 1 {
+				t.Errorf("ReadDNSQuestion() did not resume after the pointer, got QType %d QClass %d", got.QType, got.QClass)
+			}
+		})
+	}
+}
+
 func TestWriteDNSQuestion(t *testing.T) {
 	tests := []struct {
 		name     string
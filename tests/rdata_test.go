@@ -0,0 +1,142 @@
+package tests
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+
+	dns "github.com/joegrn/dns/pkg"
+)
+
+func TestRDataRoundTrip(t *testing.T) {
+	owner := []byte{7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0}
+	mail := []byte{4, 'm', 'a', 'i', 'l', 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0}
+
+	tests := []struct {
+		name   string
+		rrtype uint16
+		data   dns.RData
+		text   string
+	}{
+		{"A", dns.TypeA, &dns.ARecord{IP: net.IP{192, 0, 2, 1}}, "192.0.2.1"},
+		{"AAAA", dns.TypeAAAA, &dns.AAAARecord{IP: net.ParseIP("2001:db8::1")}, "2001:db8::1"},
+		{"NS", dns.TypeNS, &dns.NSRecord{Host: mail}, "mail.example.com."},
+		{"CNAME", dns.TypeCNAME, &dns.CNAMERecord{Target: mail}, "mail.example.com."},
+		{"PTR", dns.TypePTR, &dns.PTRRecord{Target: owner}, "example.com."},
+		{"MX", dns.TypeMX, &dns.MXRecord{Preference: 10, Exchange: mail}, "10 mail.example.com."},
+		{"TXT", dns.TypeTXT, &dns.TXTRecord{Text: []string{"v=spf1 -all", "say \"hi\""}}, `"v=spf1 -all" "say \"hi\""`},
+		{
+			"SOA",
+			dns.TypeSOA,
+			&dns.SOARecord{MName: mail, RName: owner, Serial: 2024010101, Refresh: 7200, Retry: 3600, Expire: 1209600, Minimum: 300},
+			"mail.example.com. example.com. 2024010101 7200 3600 1209600 300",
+		},
+		{"SRV", dns.TypeSRV, &dns.SRVRecord{Priority: 1, Weight: 5, Port: 5060, Target: mail}, "1 5 5060 mail.example.com."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := dns.Message{
+				ID:       1,
+				Question: []dns.DNSQuestion{{QName: owner, QType: tt.rrtype, QClass: dns.ClassIN}},
+				Answer:   []dns.DNSAnswer{{Name: owner, Type: tt.rrtype, Class: dns.ClassIN, TTL: 60, Data: tt.data}},
+			}
+
+			packed, err := message.Pack()
+			if err != nil {
+				t.Fatalf("Pack() error = %v", err)
+			}
+
+			var got dns.Message
+			if err := got.Unpack(packed); err != nil {
+				t.Fatalf("Unpack() error = %v", err)
+			}
+
+			if len(got.Answer) != 1 {
+				t.Fatalf("Unpack() returned %d answers, want 1", len(got.Answer))
+			}
+
+			answer := got.Answer[0]
+			if !reflect.DeepEqual(answer.Data, tt.data) {
+				t.Errorf("Unpack() Data = %#v, want %#v", answer.Data, tt.data)
+			}
+
+			if answer.Data.String() != tt.text {
+				t.Errorf("String() = %q, want %q", answer.Data.String(), tt.text)
+			}
+
+			// RDLength must match the bytes that follow it in the packed message
+			if int(answer.RDLength) != len(packed)-rdataOffset(packed) {
+				t.Errorf("RDLength = %d, want %d", answer.RDLength, len(packed)-rdataOffset(packed))
+			}
+		})
+	}
+}
+
+func TestRDataCompression(t *testing.T) {
+	owner := []byte{7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0}
+
+	tests := []struct {
+		name   string
+		rrtype uint16
+		data   dns.RData
+		want   []byte
+	}{
+		{
+			name:   "MX exchange is compressed",
+			rrtype: dns.TypeMX,
+			data:   &dns.MXRecord{Preference: 10, Exchange: owner},
+			want:   []byte{0x00, 0x0a, 0xC0, 0x0C},
+		},
+		{
+			name:   "SRV target is written in full",
+			rrtype: dns.TypeSRV,
+			data:   &dns.SRVRecord{Priority: 0, Weight: 0, Port: 53, Target: owner},
+			want:   append([]byte{0, 0, 0, 0, 0, 53}, owner...),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := dns.Message{
+				Question: []dns.DNSQuestion{{QName: owner, QType: tt.rrtype, QClass: dns.ClassIN}},
+				Answer:   []dns.DNSAnswer{{Name: owner, Type: tt.rrtype, Class: dns.ClassIN, Data: tt.data}},
+			}
+
+			packed, err := message.Pack()
+			if err != nil {
+				t.Fatalf("Pack() error = %v", err)
+			}
+
+			if got := packed[rdataOffset(packed):]; !bytes.Equal(got, tt.want) {
+				t.Errorf("Pack() RDATA = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadDNSAnswerBadRData(t *testing.T) {
+	input := []byte{
+		0,          // root
+		0x00, 0x01, // TYPE = A
+		0x00, 0x01, // CLASS = IN
+		0x00, 0x00, 0x00, 0x3c, // TTL = 60
+		0x00, 0x03, // RDLENGTH = 3, too short for an IPv4 address
+		192, 0, 2,
+	}
+
+	if _, err := dns.ReadDNSAnswer(bytes.NewReader(input)); err == nil {
+		t.Errorf("ReadDNSAnswer() expected an error for a short A record")
+	}
+}
+
+// rdataOffset finds the RDATA of the single answer following a single question
+// whose name is written in full and whose answer name is a two byte pointer.
+func rdataOffset(packed []byte) int {
+	offset := 12
+	for packed[offset] != 0 {
+		offset += int(packed[offset]) + 1
+	}
+	return offset + 1 + 4 + 2 + 2 + 2 + 4 + 2
+}
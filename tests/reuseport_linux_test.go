@@ -0,0 +1,108 @@
+//go:build linux
+
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	dns "github.com/joegrn/dns/pkg"
+)
+
+// serveReusePort starts one server over count sockets sharing a loopback port.
+func serveReusePort(tb testing.TB, count int) net.Addr {
+	tb.Helper()
+	packetConns, err := dns.ListenPacketReusePort("udp", "127.0.0.1:0", count)
+	if err != nil {
+		tb.Fatalf("ListenPacketReusePort() error = %v", err)
+	}
+
+	server := &dns.Server{Handler: staticHandler}
+	for _, packetConn := range packetConns {
+		go server.Serve(packetConn)
+	}
+	tb.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	})
+	return packetConns[0].LocalAddr()
+}
+
+func TestListenPacketReusePort(t *testing.T) {
+	packetConns, err := dns.ListenPacketReusePort("udp", "127.0.0.1:0", 4)
+	if err != nil {
+		t.Fatalf("ListenPacketReusePort() error = %v", err)
+	}
+	defer func() {
+		for _, packetConn := range packetConns {
+			packetConn.Close()
+		}
+	}()
+
+	if len(packetConns) != 4 {
+		t.Fatalf("len(packetConns) = %d, want 4", len(packetConns))
+	}
+	for _, packetConn := range packetConns[1:] {
+		if packetConn.LocalAddr().String() != packetConns[0].LocalAddr().String() {
+			t.Errorf("LocalAddr() = %v, want %v", packetConn.LocalAddr(), packetConns[0].LocalAddr())
+		}
+	}
+}
+
+func TestServerReusePortAnswersEveryClient(t *testing.T) {
+	addr := serveReusePort(t, 4)
+
+	// Separate client sockets hash onto different server sockets
+	for i := 0; i < 16; i++ {
+		if response := exchangeUDP(t, addr, query(t, "example.com")); len(response.Answer) != 1 {
+			t.Errorf("client %d: len(Answer) = %d, want 1", i, len(response.Answer))
+		}
+	}
+}
+
+// BenchmarkServerReusePort compares queries per second as sockets are added.
+// The gain needs several cores, for example:
+//
+//	go test ./tests -run XXX -bench ReusePort -cpu 8
+func BenchmarkServerReusePort(b *testing.B) {
+	for _, sockets := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("sockets=%d", sockets), func(b *testing.B) {
+			addr := serveReusePort(b, sockets)
+			request, err := (&dns.Message{
+				ID:       1,
+				Question: []dns.DNSQuestion{{QName: []byte{7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0}, QType: dns.TypeA, QClass: dns.ClassIN}},
+			}).Pack()
+			if err != nil {
+				b.Fatalf("Pack() error = %v", err)
+			}
+
+			start := time.Now()
+			b.RunParallel(func(pb *testing.PB) {
+				conn, err := net.Dial("udp", addr.String())
+				if err != nil {
+					b.Errorf("Dial() error = %v", err)
+					return
+				}
+				defer conn.Close()
+
+				buffer := make([]byte, dns.MaxMessageSize)
+				for pb.Next() {
+					conn.SetDeadline(time.Now().Add(time.Second))
+					if _, err := conn.Write(request); err != nil {
+						b.Errorf("Write() error = %v", err)
+						return
+					}
+					if _, err := conn.Read(buffer); err != nil {
+						b.Errorf("Read() error = %v", err)
+						return
+					}
+				}
+			})
+			b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "queries/s")
+		})
+	}
+}
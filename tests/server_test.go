@@ -0,0 +1,364 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	dns "github.com/joegrn/dns/pkg"
+)
+
+// startUDPServer serves on a loopback port picked by the kernel and shuts the
+// server down when the test ends.
+func startUDPServer(t *testing.T, server *dns.Server) net.Addr {
+	t.Helper()
+	return startUDPServerOn(t, server, "127.0.0.1:0")
+}
+
+func startUDPServerOn(t *testing.T, server *dns.Server, address string) net.Addr {
+	t.Helper()
+	packetConn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		t.Fatalf("ListenPacket() error = %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- server.Serve(packetConn) }()
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			t.Errorf("Shutdown() error = %v", err)
+		}
+		if err := <-done; !errors.Is(err, dns.ErrServerClosed) {
+			t.Errorf("Serve() error = %v, want ErrServerClosed", err)
+		}
+	})
+	return packetConn.LocalAddr()
+}
+
+func exchangeUDP(t *testing.T, addr net.Addr, request *dns.Message) *dns.Message {
+	t.Helper()
+	conn, err := net.Dial("udp", addr.String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+
+	packed, err := request.Pack()
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Write(packed); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	buffer := make([]byte, 65535)
+	n, err := conn.Read(buffer)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	var response dns.Message
+	if err := response.Unpack(buffer[:n]); err != nil {
+		t.Fatalf("Unpack() error = %v", err)
+	}
+	return &response
+}
+
+func TestServerServeUDP(t *testing.T) {
+	addr := startUDPServer(t, &dns.Server{Handler: staticHandler, ReadTimeout: 50 * time.Millisecond})
+
+	response := exchangeUDP(t, addr, query(t, "www.example.com"))
+	if response.ID != 1 || !response.Flags.QR {
+		t.Errorf("response header = %d %+v, want ID 1 with QR", response.ID, response.Flags)
+	}
+	if len(response.Answer) != 1 {
+		t.Fatalf("len(Answer) = %d, want 1", len(response.Answer))
+	}
+	if a, ok := response.Answer[0].Data.(*dns.ARecord); !ok || !a.IP.Equal(net.IPv4(8, 8, 8, 8)) {
+		t.Errorf("Answer[0].Data = %v, want A 8.8.8.8", response.Answer[0].Data)
+	}
+}
+
+func TestServerServeAfterShutdown(t *testing.T) {
+	server := &dns.Server{}
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket() error = %v", err)
+	}
+	if err := server.Serve(packetConn); !errors.Is(err, dns.ErrServerClosed) {
+		t.Errorf("Serve() error = %v, want ErrServerClosed", err)
+	}
+}
+
+func TestServerListenAndServeUnsupportedNet(t *testing.T) {
+	server := &dns.Server{Addr: "127.0.0.1:0", Net: "sctp"}
+	if err := server.ListenAndServe(); err == nil {
+		t.Error("ListenAndServe() error = nil, want unsupported network")
+	}
+}
+
+func TestServerServeUDPLargeQuery(t *testing.T) {
+	addr := startUDPServer(t, &dns.Server{Handler: staticHandler})
+
+	// Padding pushes the query past both 512 octets and the offered payload size
+	request := query(t, "www.example.com")
+	request.EDNS.Options = []dns.EDNSOption{&dns.PaddingOption{Length: 2000}}
+
+	response := exchangeUDP(t, addr, request)
+	if len(response.Answer) != 1 {
+		t.Errorf("len(Answer) = %d, want 1", len(response.Answer))
+	}
+}
+
+func TestServerResponseFlagsFromHandler(t *testing.T) {
+	// The handler leaves flags the server is responsible for wrong
+	careless := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+		var response dns.Message
+		response.SetReply(r, false, false)
+		response.Flags.Z = 1
+		response.Flags.RD = false
+		response.Flags.OpCode = 2
+		w.WriteMsg(&response)
+	})
+	mux := dns.NewServeMux()
+	mux.Handle("example.com.", careless)
+	addr := startUDPServer(t, &dns.Server{Handler: mux, RecursionAvailable: true})
+
+	for _, name := range []string{"www.example.com", "example.org"} {
+		request := query(t, name)
+		request.Flags.RD = true
+		request.Flags.CD = true
+
+		flags := exchangeUDP(t, addr, request).Flags
+		if !flags.QR || !flags.RA || !flags.RD || !flags.CD || flags.Z != 0 || flags.OpCode != 0 {
+			t.Errorf("%s: flags = %+v, want QR, RA, RD and CD with Z and OPCODE 0", name, flags)
+		}
+	}
+}
+
+func TestServerServeUDPCountsMalformed(t *testing.T) {
+	server := &dns.Server{Handler: staticHandler}
+	addr := startUDPServer(t, server)
+
+	conn, err := net.Dial("udp", addr.String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+
+	// A header promising one question that never arrives
+	malformed := []byte{0, 7, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 3, 'w', 'w'}
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Write(malformed); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	buffer := make([]byte, 512)
+	n, err := conn.Read(buffer)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	var response dns.Message
+	if err := response.Unpack(buffer[:n]); err != nil {
+		t.Fatalf("Unpack() error = %v", err)
+	}
+	if response.ID != 7 || response.RCode() != dns.RCodeFormErr {
+		t.Errorf("response = ID %d RCode %d, want ID 7 FORMERR", response.ID, response.RCode())
+	}
+	if got := server.Malformed(); got != 1 {
+		t.Errorf("Malformed() = %d, want 1", got)
+	}
+}
+
+func TestServerServeUDPConcurrent(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+		if r.ID == 1 {
+			<-release
+		}
+		staticHandler.ServeDNS(w, r)
+	})
+	addr := startUDPServer(t, &dns.Server{Handler: handler, Workers: 2})
+
+	// The first query blocks its worker; the second must still be answered
+	conn, err := net.Dial("udp", addr.String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+	blocked, err := query(t, "slow.example.com").Pack()
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+	if _, err := conn.Write(blocked); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	fast := query(t, "fast.example.com")
+	fast.ID = 2
+	if response := exchangeUDP(t, addr, fast); response.ID != 2 {
+		t.Errorf("response ID = %d, want 2", response.ID)
+	}
+}
+
+func TestServerServeUDPDropsOverLimit(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+		started <- struct{}{}
+		<-release
+		staticHandler.ServeDNS(w, r)
+	})
+	server := &dns.Server{Handler: handler, Workers: 1, MaxInFlight: 1}
+	addr := startUDPServer(t, server)
+
+	conn, err := net.Dial("udp", addr.String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	request, err := query(t, "example.com").Pack()
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+	conn.Write(request)
+	<-started
+
+	for i := 0; i < 3; i++ {
+		conn.Write(request)
+	}
+	deadline := time.Now().Add(time.Second)
+	for server.Dropped() < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := server.Dropped(); got != 3 {
+		t.Errorf("Dropped() = %d, want 3", got)
+	}
+
+	// The query that was accepted is still answered
+	close(release)
+	buffer := make([]byte, dns.MaxMessageSize)
+	if _, err := conn.Read(buffer); err != nil {
+		t.Errorf("Read() error = %v, want the in-flight response", err)
+	}
+}
+
+func TestServerShutdownDeadline(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+		close(started)
+		<-release
+	})
+	server := &dns.Server{Handler: handler}
+
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket() error = %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- server.Serve(packetConn) }()
+
+	request, err := query(t, "example.com").Pack()
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+	conn, err := net.Dial("udp", packetConn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+	conn.Write(request)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := server.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown() error = %v, want DeadlineExceeded while a query is stuck", err)
+	}
+
+	close(release)
+	if err := <-done; !errors.Is(err, dns.ErrServerClosed) {
+		t.Errorf("Serve() error = %v, want ErrServerClosed", err)
+	}
+}
+
+func TestServerListenAndServeAddrs(t *testing.T) {
+	probe, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket() error = %v", err)
+	}
+	port := probe.LocalAddr().(*net.UDPAddr).Port
+	probe.Close()
+
+	ipv4 := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}
+	ipv6 := &net.UDPAddr{IP: net.IPv6loopback, Port: port}
+	server := &dns.Server{Handler: staticHandler, Addrs: []string{ipv4.String(), ipv6.String()}}
+
+	done := make(chan error, 1)
+	go func() { done <- server.ListenAndServe() }()
+	defer func() {
+		server.Shutdown(context.Background())
+		if err := <-done; !errors.Is(err, dns.ErrServerClosed) {
+			t.Errorf("ListenAndServe() error = %v, want ErrServerClosed", err)
+		}
+	}()
+
+	// Queries sent before the sockets are bound are refused, so retry briefly
+	request, err := query(t, "example.com").Pack()
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+	for _, addr := range []net.Addr{ipv4, ipv6} {
+		answered := false
+		for attempt := 0; attempt < 50 && !answered; attempt++ {
+			if answered = tryExchangeUDP(addr, request); !answered {
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+		if !answered {
+			t.Errorf("no answer from %v", addr)
+		}
+	}
+}
+
+func TestServerListenAndServeAddrsBindFailure(t *testing.T) {
+	taken, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket() error = %v", err)
+	}
+	defer taken.Close()
+
+	server := &dns.Server{Addrs: []string{"127.0.0.1:0", taken.LocalAddr().String()}}
+	if err := server.ListenAndServe(); err == nil {
+		t.Error("ListenAndServe() error = nil, want a bind error")
+	}
+}
+
+func tryExchangeUDP(addr net.Addr, request []byte) bool {
+	conn, err := net.Dial("udp", addr.String())
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, err := conn.Write(request); err != nil {
+		return false
+	}
+	_, err = conn.Read(make([]byte, dns.MaxMessageSize))
+	return err == nil
+}
@@ -0,0 +1,228 @@
+package tests
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dns "github.com/joegrn/dns/pkg"
+)
+
+func startTCPServer(t *testing.T, server *dns.Server) net.Addr {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- server.ServeTCP(listener) }()
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			t.Errorf("Shutdown() error = %v", err)
+		}
+		if err := <-done; !errors.Is(err, dns.ErrServerClosed) {
+			t.Errorf("ServeTCP() error = %v, want ErrServerClosed", err)
+		}
+	})
+	return listener.Addr()
+}
+
+func writeTCPMessage(t *testing.T, conn net.Conn, message *dns.Message) {
+	t.Helper()
+	packed, err := message.Pack()
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+	if _, err := conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(packed))), packed...)); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+}
+
+func readTCPMessage(t *testing.T, conn net.Conn) *dns.Message {
+	t.Helper()
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		t.Fatalf("reading length: %v", err)
+	}
+	buffer := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, buffer); err != nil {
+		t.Fatalf("reading message: %v", err)
+	}
+
+	var message dns.Message
+	if err := message.Unpack(buffer); err != nil {
+		t.Fatalf("Unpack() error = %v", err)
+	}
+	return &message
+}
+
+func TestServerServeTCPPipelined(t *testing.T) {
+	// The first query is held back so its response is sent after the second
+	release := make(chan struct{})
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+		if r.ID == 1 {
+			<-release
+		}
+		staticHandler.ServeDNS(w, r)
+	})
+	addr := startTCPServer(t, &dns.Server{Handler: handler})
+
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	first := query(t, "one.example.com")
+	second := query(t, "two.example.com")
+	second.ID = 2
+	writeTCPMessage(t, conn, first)
+	writeTCPMessage(t, conn, second)
+
+	if response := readTCPMessage(t, conn); response.ID != 2 {
+		t.Errorf("first response ID = %d, want 2", response.ID)
+	}
+	close(release)
+	response := readTCPMessage(t, conn)
+	if response.ID != 1 {
+		t.Errorf("second response ID = %d, want 1", response.ID)
+	}
+	if len(response.Answer) != 1 {
+		t.Errorf("len(Answer) = %d, want 1", len(response.Answer))
+	}
+	if keepalive, ok := response.EDNS.Option(dns.OptionCodeKeepalive).(*dns.KeepaliveOption); ok {
+		t.Errorf("unexpected keepalive %+v for a query that did not ask", keepalive)
+	}
+}
+
+func TestServerServeTCPIdleTimeout(t *testing.T) {
+	addr := startTCPServer(t, &dns.Server{Handler: staticHandler, IdleTimeout: 50 * time.Millisecond})
+
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Read() error = %v, want EOF once the connection is idle", err)
+	}
+}
+
+func TestServerServeTCPMaxConnections(t *testing.T) {
+	addr := startTCPServer(t, &dns.Server{Handler: staticHandler, MaxTCPConnections: 1})
+
+	first, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer first.Close()
+	first.SetDeadline(time.Now().Add(2 * time.Second))
+
+	// A completed exchange guarantees the first connection has been accepted
+	writeTCPMessage(t, first, query(t, "example.com"))
+	readTCPMessage(t, first)
+
+	second, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer second.Close()
+	second.SetDeadline(time.Now().Add(2 * time.Second))
+
+	if _, err := second.Read(make([]byte, 1)); err == nil {
+		t.Error("Read() error = nil, want the connection over the limit to be closed")
+	}
+}
+
+func TestServerServeTCPMaxQueries(t *testing.T) {
+	release := make(chan struct{})
+	var started atomic.Int32
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+		started.Add(1)
+		<-release
+		staticHandler.ServeDNS(w, r)
+	})
+	addr := startTCPServer(t, &dns.Server{Handler: handler, MaxTCPQueries: 2})
+
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	for id := uint16(1); id <= 5; id++ {
+		request := query(t, "example.com")
+		request.ID = id
+		writeTCPMessage(t, conn, request)
+	}
+
+	// The rest stay unread until one of the first two is answered
+	time.Sleep(50 * time.Millisecond)
+	if got := started.Load(); got != 2 {
+		t.Errorf("%d queries being answered, want 2", got)
+	}
+
+	close(release)
+	for i := 0; i < 5; i++ {
+		readTCPMessage(t, conn)
+	}
+}
+
+func TestServerServeTCPIdleTimeoutMidLength(t *testing.T) {
+	// The first query stays outstanding so the connection is not idle
+	release := make(chan struct{})
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+		if r.ID == 1 {
+			<-release
+		}
+		staticHandler.ServeDNS(w, r)
+	})
+	addr := startTCPServer(t, &dns.Server{Handler: handler, IdleTimeout: 20 * time.Millisecond})
+
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	writeTCPMessage(t, conn, query(t, "one.example.com"))
+
+	second := query(t, "two.example.com")
+	second.ID = 2
+	packed, err := second.Pack()
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+	framed := append(binary.BigEndian.AppendUint16(nil, uint16(len(packed))), packed...)
+
+	// Let the read deadline pass with only the first length octet received
+	if _, err := conn.Write(framed[:1]); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, err := conn.Write(framed[1:]); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	if response := readTCPMessage(t, conn); response.ID != 2 {
+		t.Errorf("first response ID = %d, want 2", response.ID)
+	}
+	close(release)
+	if response := readTCPMessage(t, conn); response.ID != 1 {
+		t.Errorf("second response ID = %d, want 1", response.ID)
+	}
+}
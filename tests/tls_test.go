@@ -0,0 +1,226 @@
+package tests
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	dns "github.com/joegrn/dns/pkg"
+)
+
+// writeCertificate writes a self-signed certificate for 127.0.0.1 and its key
+// into dir and returns the parsed certificate.
+func writeCertificate(t *testing.T, dir, commonName string) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error = %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey() error = %v", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(filepath.Join(dir, "cert.pem"), certPEM, 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "key.pem"), keyPEM, 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate() error = %v", err)
+	}
+	return certificate
+}
+
+func startTLSServer(t *testing.T, dir string) net.Addr {
+	t.Helper()
+	reloader, err := dns.NewCertificateReloader(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+	if err != nil {
+		t.Fatalf("NewCertificateReloader() error = %v", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+
+	server := &dns.Server{Handler: staticHandler}
+	done := make(chan error, 1)
+	go func() { done <- server.ServeTLS(listener, dns.NewTLSConfig(reloader)) }()
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+		if err := <-done; !errors.Is(err, dns.ErrServerClosed) {
+			t.Errorf("ServeTLS() error = %v, want ErrServerClosed", err)
+		}
+	})
+	return listener.Addr()
+}
+
+func dialTLS(t *testing.T, addr net.Addr, config *tls.Config) *tls.Conn {
+	t.Helper()
+	conn, err := tls.Dial("tcp", addr.String(), config)
+	if err != nil {
+		t.Fatalf("tls.Dial() error = %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	return conn
+}
+
+func trusting(certificate *x509.Certificate) *tls.Config {
+	roots := x509.NewCertPool()
+	roots.AddCert(certificate)
+	return &tls.Config{RootCAs: roots, ServerName: "127.0.0.1"}
+}
+
+func TestServerServeTLS(t *testing.T) {
+	dir := t.TempDir()
+	certificate := writeCertificate(t, dir, "first")
+	addr := startTLSServer(t, dir)
+
+	conn := dialTLS(t, addr, trusting(certificate))
+	defer conn.Close()
+
+	writeTCPMessage(t, conn, query(t, "www.example.com"))
+	response := readTCPMessage(t, conn)
+	if len(response.Answer) != 1 {
+		t.Errorf("len(Answer) = %d, want 1", len(response.Answer))
+	}
+
+	// Padded even though the query did not ask for it
+	packed, err := response.Pack()
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+	if len(packed)%dns.DefaultEDNSConfig.PaddingBlockSize != 0 {
+		t.Errorf("response is %d octets, want a multiple of %d", len(packed), dns.DefaultEDNSConfig.PaddingBlockSize)
+	}
+}
+
+func TestServerServeTLSSessionResumption(t *testing.T) {
+	dir := t.TempDir()
+	config := trusting(writeCertificate(t, dir, "first"))
+	config.ClientSessionCache = tls.NewLRUClientSessionCache(1)
+	addr := startTLSServer(t, dir)
+
+	for i, wantResumed := range []bool{false, true} {
+		conn := dialTLS(t, addr, config)
+		// TLS 1.3 tickets arrive after the handshake, so read a response first
+		writeTCPMessage(t, conn, query(t, "example.com"))
+		readTCPMessage(t, conn)
+		if resumed := conn.ConnectionState().DidResume; resumed != wantResumed {
+			t.Errorf("connection %d: DidResume = %v, want %v", i, resumed, wantResumed)
+		}
+		conn.Close()
+	}
+}
+
+func TestCertificateReloaderPicksUpNewFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeCertificate(t, dir, "first")
+	addr := startTLSServer(t, dir)
+
+	second := writeCertificate(t, dir, "second")
+	// Make the change visible even on filesystems with coarse timestamps
+	later := time.Now().Add(time.Minute)
+	for _, name := range []string{"cert.pem", "key.pem"} {
+		if err := os.Chtimes(filepath.Join(dir, name), later, later); err != nil {
+			t.Fatalf("Chtimes() error = %v", err)
+		}
+	}
+
+	conn := dialTLS(t, addr, trusting(second))
+	defer conn.Close()
+	if name := conn.ConnectionState().PeerCertificates[0].Subject.CommonName; name != "second" {
+		t.Errorf("certificate CommonName = %q, want second", name)
+	}
+}
+
+func TestCertificateReloaderRetriesFailedPairOnChange(t *testing.T) {
+	dir := t.TempDir()
+	writeCertificate(t, dir, "first")
+	reloader, err := dns.NewCertificateReloader(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+	if err != nil {
+		t.Fatalf("NewCertificateReloader() error = %v", err)
+	}
+
+	touch := func(offset time.Duration) {
+		t.Helper()
+		at := time.Now().Add(offset)
+		for _, name := range []string{"cert.pem", "key.pem"} {
+			if err := os.Chtimes(filepath.Join(dir, name), at, at); err != nil {
+				t.Fatalf("Chtimes() error = %v", err)
+			}
+		}
+	}
+	commonName := func() string {
+		t.Helper()
+		certificate, err := reloader.GetCertificate(nil)
+		if err != nil {
+			t.Fatalf("GetCertificate() error = %v", err)
+		}
+		parsed, err := x509.ParseCertificate(certificate.Certificate[0])
+		if err != nil {
+			t.Fatalf("ParseCertificate() error = %v", err)
+		}
+		return parsed.Subject.CommonName
+	}
+
+	// An unreadable pair keeps the old certificate on every handshake
+	if err := os.WriteFile(filepath.Join(dir, "key.pem"), []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	touch(time.Minute)
+	for i := 0; i < 2; i++ {
+		if name := commonName(); name != "first" {
+			t.Fatalf("certificate CommonName = %q, want first", name)
+		}
+	}
+
+	writeCertificate(t, dir, "second")
+	touch(2 * time.Minute)
+	if name := commonName(); name != "second" {
+		t.Errorf("certificate CommonName = %q, want second", name)
+	}
+}
+
+func TestServeTLSRequiresConfig(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	if err := (&dns.Server{}).ServeTLS(listener, nil); err == nil {
+		t.Error("ServeTLS() error = nil, want missing config")
+	}
+}
@@ -0,0 +1,140 @@
+package tests
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	dns "github.com/joegrn/dns/pkg"
+)
+
+func aRecords(t *testing.T, name string, count int) []dns.DNSAnswer {
+	t.Helper()
+	owner, err := dns.ParseName(name)
+	if err != nil {
+		t.Fatalf("ParseName() error = %v", err)
+	}
+	records := make([]dns.DNSAnswer, count)
+	for i := range records {
+		records[i] = dns.DNSAnswer{
+			Name:  owner,
+			Type:  dns.TypeA,
+			Class: dns.ClassIN,
+			TTL:   60,
+			Data:  &dns.ARecord{IP: net.IPv4(10, 0, byte(i>>8), byte(i))},
+		}
+	}
+	return records
+}
+
+func TestMessageTruncate(t *testing.T) {
+	tests := []struct {
+		name           string
+		answer         int
+		additional     int
+		size           int
+		wantAnswer     int
+		wantAdditional int
+		wantTC         bool
+	}{
+		{name: "Fits", answer: 2, additional: 2, size: 512, wantAnswer: 2, wantAdditional: 2},
+		{name: "Additional dropped without TC", answer: 2, additional: 40, size: 512, wantAnswer: 2},
+		{name: "Answer RRset dropped whole", answer: 40, additional: 2, size: 512, wantTC: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := query(t, "example.com")
+			message.Flags.QR = true
+			message.Answer = aRecords(t, "example.com", tt.answer)
+			message.Additional = aRecords(t, "ns.example.com", tt.additional)
+
+			packed, err := message.Truncate(tt.size)
+			if err != nil {
+				t.Fatalf("Truncate() error = %v", err)
+			}
+			if len(packed) > tt.size {
+				t.Errorf("len(packed) = %d, want at most %d", len(packed), tt.size)
+			}
+
+			var got dns.Message
+			if err := got.Unpack(packed); err != nil {
+				t.Fatalf("Unpack() error = %v", err)
+			}
+			if len(got.Answer) != tt.wantAnswer || len(got.Additional) != tt.wantAdditional {
+				t.Errorf("got %d answers and %d additional, want %d and %d",
+					len(got.Answer), len(got.Additional), tt.wantAnswer, tt.wantAdditional)
+			}
+			if got.Flags.TC != tt.wantTC {
+				t.Errorf("TC = %v, want %v", got.Flags.TC, tt.wantTC)
+			}
+			if got.EDNS == nil {
+				t.Error("OPT record was dropped")
+			}
+		})
+	}
+}
+
+func TestMessageTruncateKeepsEarlierRRsets(t *testing.T) {
+	message := query(t, "example.com")
+	message.Answer = append(aRecords(t, "example.com", 1), aRecords(t, "www.example.com", 40)...)
+
+	packed, err := message.Truncate(512)
+	if err != nil {
+		t.Fatalf("Truncate() error = %v", err)
+	}
+
+	var got dns.Message
+	if err := got.Unpack(packed); err != nil {
+		t.Fatalf("Unpack() error = %v", err)
+	}
+	if len(got.Answer) != 1 || !got.Flags.TC {
+		t.Errorf("got %d answers with TC=%v, want the first RRset with TC set", len(got.Answer), got.Flags.TC)
+	}
+}
+
+func TestHandleDnsRequestTruncatesUDP(t *testing.T) {
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+		var response dns.Message
+		response.SetReply(r, true, false)
+		response.Answer = aRecords(t, "example.com", 100)
+		w.WriteMsg(&response)
+	})
+
+	request, err := query(t, "example.com").Pack()
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+
+	transports := []struct {
+		source  net.Addr
+		wantTC  bool
+		maxSize int
+	}{
+		{source: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53000}, wantTC: true, maxSize: 1232},
+		{source: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53000}, maxSize: dns.MaxMessageSize},
+	}
+
+	for _, transport := range transports {
+		t.Run(fmt.Sprintf("%T", transport.source), func(t *testing.T) {
+			raw := dns.HandleDnsRequest(handler, localAddr, transport.source, request)
+			if len(raw) > transport.maxSize {
+				t.Errorf("len(response) = %d, want at most %d", len(raw), transport.maxSize)
+			}
+
+			var response dns.Message
+			if err := response.Unpack(raw); err != nil {
+				t.Fatalf("Unpack() error = %v", err)
+			}
+			if response.Flags.TC != transport.wantTC {
+				t.Errorf("TC = %v, want %v", response.Flags.TC, transport.wantTC)
+			}
+			if response.EDNS == nil {
+				t.Error("OPT record was dropped")
+			}
+			if !transport.wantTC && len(response.Answer) != 100 {
+				t.Errorf("len(Answer) = %d, want 100", len(response.Answer))
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package tests
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	dns "github.com/joegrn/dns/pkg"
+)
+
+func TestMessageWriterWriteName(t *testing.T) {
+	tests := []struct {
+		name    string
+		names   [][]byte
+		want    []byte
+		wantErr bool
+	}{
+		{
+			name: "Repeated name becomes a pointer",
+			names: [][]byte{
+				{7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0},
+				{7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0},
+			},
+			want: []byte{
+				7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0,
+				0xC0, 0x00, // pointer to offset 0
+			},
+			wantErr: false,
+		},
+		{
+			name: "Shared suffix is compressed",
+			names: [][]byte{
+				{7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0},
+				{3, 'w', 'w', 'w', 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0},
+				{4, 'm', 'a', 'i', 'l', 3, 'c', 'o', 'm', 0},
+			},
+			want: []byte{
+				7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0,
+				3, 'w', 'w', 'w', 0xC0, 0x00, // www + pointer to example.com
+				4, 'm', 'a', 'i', 'l', 0xC0, 0x08, // mail + pointer to com
+			},
+			wantErr: false,
+		},
+		{
+			name: "Root name is never compressed",
+			names: [][]byte{
+				{0},
+				{0},
+			},
+			want:    []byte{0, 0},
+			wantErr: false,
+		},
+		{
+			name: "Unterminated name",
+			names: [][]byte{
+				{7, 'e', 'x', 'a'},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buffer := new(bytes.Buffer)
+			writer := dns.NewMessageWriter(buffer)
+
+			var err error
+			for _, name := range tt.names {
+				if err = writer.WriteName(name); err != nil {
+					break
+				}
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("WriteName() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr && !reflect.DeepEqual(buffer.Bytes(), tt.want) {
+				t.Errorf("WriteName() = %v, want %v", buffer.Bytes(), tt.want)
+			}
+		})
+	}
+}
+
+func TestMessageWriterScope(t *testing.T) {
+	name := []byte{7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0}
+
+	first := new(bytes.Buffer)
+	if err := dns.NewMessageWriter(first).WriteName(name); err != nil {
+		t.Fatalf("WriteName() error = %v", err)
+	}
+
+	// A new writer must not reuse offsets recorded for another message
+	second := new(bytes.Buffer)
+	if err := dns.NewMessageWriter(second).WriteName(name); err != nil {
+		t.Fatalf("WriteName() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(second.Bytes(), name) {
+		t.Errorf("WriteName() = %v, want %v", second.Bytes(), name)
+	}
+}
@@ -0,0 +1,162 @@
+package tests
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	dns "github.com/joegrn/dns/pkg"
+)
+
+func mustParseName(t *testing.T, name string) []byte {
+	t.Helper()
+	wire, err := dns.ParseName(name)
+	if err != nil {
+		t.Fatalf("ParseName(%q) error = %v", name, err)
+	}
+	return wire
+}
+
+func TestParseZone(t *testing.T) {
+	zone := `$ORIGIN example.com.
+$TTL 1h
+@	IN	SOA	ns1 hostmaster (
+		2024010101 ; serial
+		7200       ; refresh
+		3600 1209600
+		300 )
+	IN	NS	ns1
+	IN	MX	10 mail.example.net.
+ns1	300	A	192.0.2.1 ; glue
+www	IN 60	AAAA	2001:db8::1
+	TXT	"v=spf1 -all" "semi;colon"
+$ORIGIN sub
+host	A	192.0.2.2
+`
+	records, err := dns.ParseZone(strings.NewReader(zone), "")
+	if err != nil {
+		t.Fatalf("ParseZone() error = %v", err)
+	}
+
+	origin := mustParseName(t, "example.com.")
+	want := []dns.DNSAnswer{
+		{Name: origin, Type: dns.TypeSOA, Class: dns.ClassIN, TTL: 3600, Data: &dns.SOARecord{
+			MName: mustParseName(t, "ns1.example.com."), RName: mustParseName(t, "hostmaster.example.com."),
+			Serial: 2024010101, Refresh: 7200, Retry: 3600, Expire: 1209600, Minimum: 300,
+		}},
+		{Name: origin, Type: dns.TypeNS, Class: dns.ClassIN, TTL: 3600, Data: &dns.NSRecord{Host: mustParseName(t, "ns1.example.com.")}},
+		{Name: origin, Type: dns.TypeMX, Class: dns.ClassIN, TTL: 3600, Data: &dns.MXRecord{Preference: 10, Exchange: mustParseName(t, "mail.example.net.")}},
+		{Name: mustParseName(t, "ns1.example.com."), Type: dns.TypeA, Class: dns.ClassIN, TTL: 300, Data: &dns.ARecord{IP: net.IP{192, 0, 2, 1}}},
+		{Name: mustParseName(t, "www.example.com."), Type: dns.TypeAAAA, Class: dns.ClassIN, TTL: 60, Data: &dns.AAAARecord{IP: net.ParseIP("2001:db8::1")}},
+		{Name: mustParseName(t, "www.example.com."), Type: dns.TypeTXT, Class: dns.ClassIN, TTL: 3600, Data: &dns.TXTRecord{Text: []string{"v=spf1 -all", "semi;colon"}}},
+		{Name: mustParseName(t, "host.sub.example.com."), Type: dns.TypeA, Class: dns.ClassIN, TTL: 3600, Data: &dns.ARecord{IP: net.IP{192, 0, 2, 2}}},
+	}
+
+	if len(records) != len(want) {
+		t.Fatalf("ParseZone() returned %d records, want %d:\n%v", len(records), len(want), records)
+	}
+	for i := range want {
+		if !reflect.DeepEqual(records[i], want[i]) {
+			t.Errorf("record %d = %v, want %v", i, records[i], want[i])
+		}
+	}
+}
+
+func TestParseZoneTTLInheritance(t *testing.T) {
+	// Without $TTL a record takes the TTL of the one before it
+	zone := "a 120 IN A 192.0.2.1\nb A 192.0.2.2\n$TTL 1d2h\nc A 192.0.2.3\n"
+	records, err := dns.ParseZone(strings.NewReader(zone), "example.com")
+	if err != nil {
+		t.Fatalf("ParseZone() error = %v", err)
+	}
+
+	want := []uint32{120, 120, 93600}
+	for i, ttl := range want {
+		if records[i].TTL != ttl {
+			t.Errorf("record %d TTL = %d, want %d", i, records[i].TTL, ttl)
+		}
+	}
+}
+
+func TestParseZoneGenerate(t *testing.T) {
+	zone := "$TTL 300\n$GENERATE 1-10/4 host-${100,4,x} A 192.0.2.$\n"
+	records, err := dns.ParseZone(strings.NewReader(zone), "example.com.")
+	if err != nil {
+		t.Fatalf("ParseZone() error = %v", err)
+	}
+
+	var got []string
+	for _, record := range records {
+		got = append(got, dns.NameToString(record.Name)+" "+record.Data.String())
+	}
+	want := []string{
+		"host-0065.example.com. 192.0.2.1",
+		"host-0069.example.com. 192.0.2.5",
+		"host-006d.example.com. 192.0.2.9",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("generated %v, want %v", got, want)
+	}
+}
+
+func TestParseZoneFileInclude(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, contents string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile("hosts.zone", "www A 192.0.2.1\n$ORIGIN elsewhere.\n")
+	writeFile("example.zone", "$TTL 60\n$INCLUDE hosts.zone lab\nmail A 192.0.2.2\n")
+
+	records, err := dns.ParseZoneFile(filepath.Join(dir, "example.zone"), "example.com.")
+	if err != nil {
+		t.Fatalf("ParseZoneFile() error = %v", err)
+	}
+
+	// The included file's $ORIGIN does not carry back into the parent
+	var got []string
+	for _, record := range records {
+		got = append(got, dns.NameToString(record.Name))
+	}
+	want := []string{"www.lab.example.com.", "mail.example.com."}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("names = %v, want %v", got, want)
+	}
+}
+
+func TestParseZoneErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		zone     string
+		wantLine int
+	}{
+		{name: "Unknown type", zone: "$TTL 60\nwww A 192.0.2.1\nwww BOGUS 1\n", wantLine: 3},
+		{name: "Bad address", zone: "$TTL 60\n\n; comment\nwww A 300.0.0.1\n", wantLine: 4},
+		{name: "Error reported at start of entry", zone: "$TTL 60\n@ SOA ns host (\n 1 2 3\n 4 )\n", wantLine: 2},
+		{name: "Unclosed parenthesis", zone: "$TTL 60\n@ SOA ns host ( 1 2 3 4 5\n", wantLine: 2},
+		{name: "Stray closing parenthesis", zone: "$TTL 60\nwww A 192.0.2.1 )\n", wantLine: 2},
+		{name: "No TTL", zone: "www A 192.0.2.1\n", wantLine: 1},
+		{name: "No previous owner", zone: "$TTL 60\n  A 192.0.2.1\n", wantLine: 2},
+		{name: "Unknown directive", zone: "$TTL 60\n$BOGUS x\n", wantLine: 2},
+		{name: "Missing include", zone: "$INCLUDE does-not-exist.zone\n", wantLine: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := dns.ParseZone(strings.NewReader(tt.zone), "example.com.")
+
+			var zoneErr *dns.ZoneError
+			if !errors.As(err, &zoneErr) {
+				t.Fatalf("ParseZone() error = %v, want a ZoneError", err)
+			}
+			if zoneErr.Line != tt.wantLine {
+				t.Errorf("error line = %d, want %d (%v)", zoneErr.Line, tt.wantLine, err)
+			}
+		})
+	}
+}